@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/generator"
+	"github.com/gera2ld/caddy-gen/internal/service"
+	"github.com/gera2ld/caddy-gen/internal/validate"
+)
+
+// configWatchInterval is the delay between checks of the config file for changes
+const configWatchInterval = 2 * time.Second
+
+// command is a subcommand of caddy-gen
+type command struct {
+	name  string
+	args  []string // Names of the positional arguments
+	usage string
+	run   func(inv *invocation) int
+}
+
+// invocation holds the parsed command line and the service of a subcommand
+type invocation struct {
+	flags []string // Flags of the command line, loaded again on reload
+	args  []string // Positional arguments after the flags
+	cfg   *config.Config
+	svc   *service.Service
+}
+
+// commands lists the subcommands
+var commands = []*command{
+	{name: "watch", usage: "update the config on Docker events until stopped (default)", run: runWatch},
+	{name: "once", usage: "update the config once, then exit", run: runOnce},
+	{name: "print", usage: "print the config without writing it", run: runPrint},
+	{name: "validate", usage: "check the labels of all containers and the generated config", run: runValidate},
+	{name: "explain", args: []string{"<host>"}, usage: "show the containers, labels and bindings routing a host", run: runExplain},
+}
+
+// findCommand returns the subcommand with a name, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// synopsis returns the name and arguments of a subcommand
+func (c *command) synopsis() string {
+	return strings.Join(append([]string{c.name}, c.args...), " ")
+}
+
+// runWatch runs the service until SIGINT or SIGTERM, reloading the settings on SIGHUP or
+// config file changes
+func runWatch(inv *invocation) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle signals
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	// Watch the config file, changes are coalesced while a reload is running
+	fileCh := make(chan struct{}, 1)
+	if inv.cfg.File != "" {
+		go config.WatchFile(ctx, inv.cfg.File, configWatchInterval, func() {
+			select {
+			case fileCh <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	// Run service
+	go func() {
+		if err := inv.svc.Run(ctx); err != nil {
+			log.Fatalf("Service error: %v", err)
+		}
+	}()
+
+	// Wait for signal
+	for {
+		select {
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				log.Printf("Received signal: %v, reloading settings...", sig)
+				reload(inv)
+				continue
+			}
+			log.Printf("Received signal: %v, shutting down...", sig)
+			return exitOK
+		case <-fileCh:
+			log.Printf("Config file changed: %s, reloading settings...", inv.cfg.File)
+			reload(inv)
+		}
+	}
+}
+
+// reload loads the settings again and applies them, keeping the current ones if they are invalid
+func reload(inv *invocation) {
+	cfg, _, err := config.Load("caddy-gen watch", inv.flags, os.Stderr)
+	if err == nil {
+		err = inv.svc.Reload(cfg)
+	}
+	if err != nil {
+		log.Printf("Failed to reload settings, keeping the current ones: %v", err)
+	}
+}
+
+// runOnce writes the config and notifies if it changed
+func runOnce(inv *invocation) int {
+	err := inv.svc.Once()
+	if pending := inv.svc.Generator().Pending(); pending > 0 {
+		log.Printf("%d sites are not ready and were left out", pending)
+	}
+	var validateErr *validate.Error
+	switch {
+	case errors.As(err, &validateErr):
+		return exitInvalid
+	case err != nil:
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runPrint writes the config to stdout
+func runPrint(inv *invocation) int {
+	content, err := inv.svc.Generator().GenerateConfig()
+	if err != nil {
+		log.Printf("Failed to generate config: %v", err)
+		return exitFailure
+	}
+	fmt.Print(content)
+	return exitOK
+}
+
+// runValidate reports invalid labels and checks the generated config with Caddy
+func runValidate(inv *invocation) int {
+	gen := inv.svc.Generator()
+	content, err := gen.GenerateConfig()
+	if err != nil {
+		log.Printf("Failed to generate config: %v", err)
+		return exitFailure
+	}
+
+	problems := gen.Problems()
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	// The command is asked to check the config, so CADDY_GEN_VALIDATE does not turn it off
+	if inv.cfg.Format == config.FormatCaddyfile {
+		if err := validate.Caddyfile(content, inv.cfg.Layout); err != nil {
+			fmt.Printf("generated config: %v\n", err)
+			return exitInvalid
+		}
+	}
+	if len(problems) > 0 {
+		return exitInvalid
+	}
+	if inv.cfg.Format == config.FormatJSON {
+		fmt.Printf("Labels OK: %d sites, the JSON config is not checked by Caddy\n", len(gen.Sites()))
+		return exitOK
+	}
+	fmt.Printf("OK: %d sites\n", len(gen.Sites()))
+	return exitOK
+}
+
+// runExplain prints the sites routing a host, with their containers, labels and bindings
+func runExplain(inv *invocation) int {
+	gen := inv.svc.Generator()
+	if _, err := gen.GenerateConfig(); err != nil {
+		log.Printf("Failed to generate config: %v", err)
+		return exitFailure
+	}
+
+	host := inv.args[0]
+	sites := gen.SitesFor(host)
+	if len(sites) == 0 {
+		fmt.Printf("No routes for %s\n", host)
+		for _, problem := range gen.Problems() {
+			fmt.Printf("  %v\n", problem)
+		}
+		return exitFailure
+	}
+
+	hostnames := ""
+	for _, site := range sites {
+		if joined := strings.Join(site.Hostnames, " "); joined != hostnames {
+			hostnames = joined
+			fmt.Println(hostnames)
+		}
+		explainSite(gen, site)
+	}
+	if pending := gen.Pending(); pending > 0 {
+		fmt.Printf("%d sites are not ready and not shown\n", pending)
+	}
+	return exitOK
+}
+
+// explainSite prints a site and the labels of its container or service
+func explainSite(gen *generator.Generator, site generator.SiteConfig) {
+	name := site.Name
+	if site.Source != "" {
+		name = fmt.Sprintf("%s (%s)", site.Name, site.Source)
+	}
+	fmt.Printf("  %s from %s\n", name, site.Origin)
+
+	path := site.PathMatcher
+	if path == "" {
+		path = "*"
+	}
+	fmt.Printf("    path:      %s\n", path)
+	fmt.Printf("    upstreams: %s\n", strings.Join(site.Upstreams(), " "))
+	if site.Priority != 0 {
+		fmt.Printf("    priority:  %d\n", site.Priority)
+	}
+	for _, directive := range site.HostDirectives {
+		fmt.Printf("    site:      %s\n", directive)
+	}
+	for _, directive := range site.ProxyDirectives {
+		fmt.Printf("    proxy:     %s\n", directive)
+	}
+
+	labels := gen.Labels(site)
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		fmt.Println("    labels:")
+	}
+	for _, key := range keys {
+		fmt.Printf("      %s=%s\n", key, labels[key])
+	}
+}
@@ -0,0 +1,49 @@
+package caddyfile
+
+import "strings"
+
+// Format parses a Caddyfile and prints it like caddy fmt
+func Format(input string) (string, error) {
+	nodes, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return Print(nodes), nil
+}
+
+// Print prints nodes with tab indentation, one directive per line, keeping single empty lines
+func Print(nodes []*Node) string {
+	var b strings.Builder
+	printNodes(&b, nodes, 0)
+	return b.String()
+}
+
+// printNodes prints nodes at an indentation depth
+func printNodes(b *strings.Builder, nodes []*Node, depth int) {
+	indent := strings.Repeat("\t", depth)
+	for i, node := range nodes {
+		if i > 0 && node.BlankBefore {
+			b.WriteString("\n")
+		}
+		b.WriteString(indent)
+
+		var parts []string
+		for _, token := range node.Tokens {
+			parts = append(parts, token.Text)
+		}
+		if node.HasBlock {
+			parts = append(parts, "{")
+		}
+		if node.Comment != nil {
+			parts = append(parts, node.Comment.Text)
+		}
+		b.WriteString(strings.Join(parts, " "))
+		b.WriteString("\n")
+
+		if node.HasBlock {
+			printNodes(b, node.Block, depth+1)
+			b.WriteString(indent)
+			b.WriteString("}\n")
+		}
+	}
+}
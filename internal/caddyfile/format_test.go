@@ -0,0 +1,71 @@
+package caddyfile
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "directive",
+			input: "  reverse_proxy   /api/*  172.17.0.2:80  ",
+			want:  "reverse_proxy /api/* 172.17.0.2:80\n",
+		},
+		{
+			name:  "nested blocks",
+			input: "example.com {\n    tls {\n  dns cloudflare {env.CF_API_TOKEN}\n    }\n  # web\n reverse_proxy {\n to a:80 # upstream\n }\n}",
+			want:  "example.com {\n\ttls {\n\t\tdns cloudflare {env.CF_API_TOKEN}\n\t}\n\t# web\n\treverse_proxy {\n\t\tto a:80 # upstream\n\t}\n}\n",
+		},
+		{
+			name:  "blocks on one line",
+			input: `tls { dns cloudflare {env.CF_API_TOKEN} } `,
+			want:  "tls {\n\tdns cloudflare {env.CF_API_TOKEN}\n}\n",
+		},
+		{
+			name:  "empty lines",
+			input: "a {\n}\n\n\n\nb\n\n# c",
+			want:  "a {\n}\n\nb\n\n# c\n",
+		},
+		{
+			name:  "global options",
+			input: "{\n  email admin@example.com\n}",
+			want:  "{\n\temail admin@example.com\n}\n",
+		},
+		{
+			name:  "heredoc",
+			input: "handle {\n  respond <<EOF\n    hi  there\n  {\n    EOF 200\n  }",
+			want:  "handle {\n\trespond <<EOF\n    hi  there\n  {\n    EOF 200\n}\n",
+		},
+		{
+			name:  "quoted braces",
+			input: `header Strict-Transport-Security "{ max-age=31536000; }"`,
+			want:  "header Strict-Transport-Security \"{ max-age=31536000; }\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.input)
+			if err != nil || got != tt.want {
+				t.Errorf("Format() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"header {":                  "line 1, column 8: unclosed {",
+		"tls internal\n}":           "line 2, column 1: unexpected }",
+		"a {\n  b {\n}":             "line 1, column 3: unclosed {",
+		"handle { respond ok } foo": "line 1, column 23: unexpected foo after }",
+		`respond "ok`:               "line 1, column 9: unterminated quote \"",
+		"respond <<EOF\nhi\nEOFX":   "line 1, column 9: unterminated heredoc <<EOF",
+	}
+	for input, want := range tests {
+		if _, err := Parse(input); err == nil || err.Error() != want {
+			t.Errorf("Parse(%q) error = %v; want %s", input, err, want)
+		}
+	}
+}
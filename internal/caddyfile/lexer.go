@@ -0,0 +1,154 @@
+// Package caddyfile tokenizes, parses and formats Caddyfile snippets
+package caddyfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Token is a word, quoted string or comment of a Caddyfile, with its raw text
+type Token struct {
+	Text    string // Raw text, including quotes
+	Line    int    // Line of the first byte, counted from 1
+	Column  int    // Column of the first byte, counted from 1
+	Offset  int    // Byte offset of the first byte
+	Quoted  bool   // Double quoted or backtick string
+	Comment bool   // Comment up to the end of the line
+}
+
+// endLine returns the line of the last byte of a token, quoted strings may span lines
+func (t Token) endLine() int {
+	return t.Line + strings.Count(t.Text, "\n")
+}
+
+// isOpen reports whether the token opens a block
+func (t Token) isOpen() bool {
+	return !t.Quoted && !t.Comment && t.Text == "{"
+}
+
+// isClose reports whether the token closes a block
+func (t Token) isClose() bool {
+	return !t.Quoted && !t.Comment && t.Text == "}"
+}
+
+// heredocRe matches the opening of a heredoc, a marker like <<EOF at the end of a line
+var heredocRe = regexp.MustCompile(`^<<([A-Za-z0-9_-]+)\r?\n`)
+
+// heredocEnd returns the end of a heredoc opened at the start of input, after its marker on a
+// later line of its own, which arguments may follow like "EOF 200", or -1 if it is not closed
+func heredocEnd(input, marker string) int {
+	offset := strings.IndexByte(input, '\n') + 1
+	for offset < len(input) {
+		line := input[offset:]
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if rest := line[indent:]; strings.HasPrefix(rest, marker) &&
+			(len(rest) == len(marker) || strings.ContainsRune(" \t\r", rune(rest[len(marker)]))) {
+			return offset + indent + len(marker)
+		}
+		offset += len(line) + 1
+	}
+	return -1
+}
+
+// Error is a syntax error in a Caddyfile
+type Error struct {
+	Line   int
+	Column int
+	Offset int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// newError creates an error at the position of a token
+func newError(token Token, format string, args ...interface{}) *Error {
+	return &Error{Line: token.Line, Column: token.Column, Offset: token.Offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Lex splits a Caddyfile into tokens like Caddy does: quotes only open a string at the start
+// of a token, a backslash escapes the next byte, and comments start with # at the start of a token.
+// A heredoc, from <<EOF to the line holding only EOF, is one quoted token kept as written.
+func Lex(input string) ([]Token, error) {
+	var tokens []Token
+	line, column := 1, 1
+
+	advance := func(ch byte) {
+		if ch == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	for i := 0; i < len(input); {
+		ch := input[i]
+		if ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' {
+			advance(ch)
+			i++
+			continue
+		}
+
+		token := Token{Line: line, Column: column, Offset: i}
+		start := i
+		switch {
+		case ch == '#':
+			token.Comment = true
+			for i < len(input) && input[i] != '\n' {
+				advance(input[i])
+				i++
+			}
+		case ch == '"' || ch == '`':
+			token.Quoted = true
+			advance(ch)
+			i++
+			closed := false
+			for i < len(input) {
+				c := input[i]
+				if c == '\\' && ch == '"' && i+1 < len(input) {
+					advance(c)
+					advance(input[i+1])
+					i += 2
+					continue
+				}
+				advance(c)
+				i++
+				if c == ch {
+					closed = true
+					break
+				}
+			}
+			if !closed {
+				return nil, newError(token, "unterminated quote %c", ch)
+			}
+		case heredocRe.MatchString(input[i:]):
+			token.Quoted = true
+			marker := heredocRe.FindStringSubmatch(input[i:])[1]
+			end := heredocEnd(input[i:], marker)
+			if end < 0 {
+				return nil, newError(token, "unterminated heredoc <<%s", marker)
+			}
+			for end += i; i < end; i++ {
+				advance(input[i])
+			}
+		default:
+			for i < len(input) && !strings.ContainsRune(" \t\r\n", rune(input[i])) {
+				if input[i] == '\\' && i+1 < len(input) && input[i+1] != '\n' {
+					advance(input[i])
+					i++
+				}
+				advance(input[i])
+				i++
+			}
+		}
+		token.Text = input[start:i]
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,37 @@
+package caddyfile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tokens, err := Lex("header X-A \"a \\\"b\\\" c\" # note\n  `x\ny` a\\ b {env.HOST}")
+	if err != nil {
+		t.Fatalf("Lex() error = %v", err)
+	}
+
+	var texts []string
+	for _, token := range tokens {
+		texts = append(texts, token.Text)
+	}
+	want := []string{"header", "X-A", `"a \"b\" c"`, "# note", "`x\ny`", `a\ b`, "{env.HOST}"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("Lex() = %q; want %q", texts, want)
+	}
+	if !tokens[2].Quoted || !tokens[3].Comment || tokens[4].Line != 2 || tokens[4].Column != 3 || tokens[5].Line != 3 {
+		t.Errorf("Lex() = %+v; want positions and kinds of the tokens", tokens)
+	}
+
+	// A heredoc is one token up to its closing marker, arguments may follow the marker
+	tokens, err = Lex("respond <<EOF\n  a  b\n  # c {\n  EOF 200")
+	if err != nil || len(tokens) != 3 || tokens[1].Text != "<<EOF\n  a  b\n  # c {\n  EOF" || !tokens[1].Quoted || tokens[2].Line != 4 {
+		t.Errorf("Lex(heredoc) = %+v, %v; want respond, the heredoc and 200", tokens, err)
+	}
+
+	for _, input := range []string{`header "a`, "respond `a", "respond <<EOF\na"} {
+		if _, err := Lex(input); err == nil {
+			t.Errorf("Lex(%q) error = nil; want unterminated quote", input)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package caddyfile
+
+// Node is a directive with its arguments, a comment line, or both, and an optional block
+type Node struct {
+	Tokens      []Token // Directive name and arguments, empty for comment lines and global options
+	Comment     *Token  // Comment at the end of the line
+	Block       []*Node // Nodes inside the block
+	HasBlock    bool    // Whether the directive has a block, which may be empty
+	BlankBefore bool    // Whether an empty line precedes the node
+}
+
+// Parse parses a Caddyfile into nodes. A directive ends at the end of the line, "{" at the end
+// of a directive opens a block and "}" closes it. Blocks may also be written on one line, like
+// "tls { dns cloudflare {env.CF_API_TOKEN} }", which formatting splits into several lines.
+func Parse(input string) ([]*Node, error) {
+	tokens, err := Lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	nodes, err := p.parseBlock(nil)
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// parser holds the position in the tokens
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+// parseBlock parses nodes up to the "}" closing the block opened by the given token,
+// or up to the end of the input at the top level
+func (p *parser) parseBlock(open *Token) ([]*Node, error) {
+	var nodes []*Node
+	var current *Node
+	lastLine := 0
+	if open != nil {
+		lastLine = open.Line
+	}
+
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		p.pos++
+		sameLine := current != nil && token.Line == lastLine
+
+		switch {
+		case token.isClose():
+			if open == nil {
+				return nil, newError(token, "unexpected }")
+			}
+			return nodes, nil
+
+		case token.Comment:
+			if sameLine {
+				current.Comment = &token
+			} else {
+				nodes = append(nodes, &Node{Comment: &token, BlankBefore: blankBefore(nodes, token, lastLine)})
+			}
+			current = nil
+			lastLine = token.Line
+
+		case token.isOpen():
+			if !sameLine {
+				// A block without a directive, like the global options block
+				current = &Node{BlankBefore: blankBefore(nodes, token, lastLine)}
+				nodes = append(nodes, current)
+			}
+			block, err := p.parseBlock(&token)
+			if err != nil {
+				return nil, err
+			}
+			current.Block, current.HasBlock = block, true
+
+			// Only a comment or another "}" may follow the closing brace on its line
+			closing := p.tokens[p.pos-1]
+			if p.pos < len(p.tokens) {
+				next := p.tokens[p.pos]
+				if next.Line == closing.Line && !next.isClose() && !next.Comment {
+					return nil, newError(next, "unexpected %s after }", next.Text)
+				}
+			}
+			current = nil
+			lastLine = closing.Line
+
+		default:
+			if !sameLine {
+				current = &Node{BlankBefore: blankBefore(nodes, token, lastLine)}
+				nodes = append(nodes, current)
+			}
+			current.Tokens = append(current.Tokens, token)
+			lastLine = token.endLine()
+		}
+	}
+
+	if open != nil {
+		return nil, newError(*open, "unclosed {")
+	}
+	return nodes, nil
+}
+
+// blankBefore reports whether an empty line separates a token from the previous node
+func blankBefore(nodes []*Node, token Token, lastLine int) bool {
+	return len(nodes) > 0 && token.Line > lastLine+1
+}
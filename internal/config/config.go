@@ -1,32 +1,220 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Network string       // Docker network to monitor
-	OutFile string       // Output file for Caddy configuration
-	Notify  *NotifyConfig // Notification configuration
+	Networks      []string      `json:"networks"`      // Docker networks to monitor, in fallback order
+	OutFile       string        `json:"outFile"`       // Output file for Caddy configuration
+	Notify        *NotifyConfig `json:"notify"`        // Notification configuration
+	Format        string        `json:"format"`        // Output format, either "caddyfile" or "json"
+	Layout        string        `json:"layout"`        // Caddyfile layout, either "handle" or "site"
+	Mode          string        `json:"mode"`          // Discovery mode, either "container" or "swarm"
+	SwarmEndpoint string        `json:"swarmEndpoint"` // Swarm upstream, either "vip" for the service VIP or "tasks" for the task IPs
+	Hosts         []HostConfig  `json:"hosts"`         // Docker hosts to aggregate, the local daemon from the environment if empty
+	Health        string        `json:"health"`        // Default readiness gating, overridden by the virtual.health label
+	Upstream      string        `json:"upstream"`      // Default upstream addressing, overridden by the virtual.upstream label
+	Published     bool          `json:"published"`     // Include containers outside the networks via host networking or published ports
+	HostGateway   string        `json:"hostGateway"`   // Address of the Docker host as seen from Caddy, e.g. host.docker.internal
+	IPFamily      string        `json:"ipFamily"`      // Preferred IP family of upstream addresses, overridden by the virtual.ip_family label
+	Validate      bool          `json:"validate"`      // Adapt the generated Caddyfile with Caddy before writing it
+	RejectedFile  string        `json:"rejectedFile"`  // File to write rejected configs to for debugging, disabled if empty
+	StatusFile    string        `json:"statusFile"`    // File to write the outcome of the last config change to, disabled if empty
+	File          string        `json:"-"`             // Config file the settings were loaded from, if any
 }
 
+// Supported readiness gating modes
+const (
+	HealthAuto   = "auto"   // Wait for a Docker healthcheck if the container has one, otherwise for running
+	HealthDocker = "docker" // Same as auto, but named explicitly
+	HealthTCP    = "tcp"    // Wait for a TCP connection to the upstream
+	HealthHTTP   = "http"   // Wait for an HTTP response below 500 from the upstream, e.g. http:/healthz
+	HealthNone   = "none"   // Route containers as soon as they are listed
+)
+
+// Supported upstream addressing modes
+const (
+	UpstreamIP      = "ip"      // Container IP on the network
+	UpstreamName    = "name"    // Container name, resolved by Docker's embedded DNS
+	UpstreamService = "service" // Compose service name
+	UpstreamAlias   = "alias"   // Network alias, falling back to the compose service and container name
+)
+
+// Supported IP family preferences
+const (
+	IPFamilyV4   = "v4"   // IPv4 address, falling back to IPv6 on IPv6-only networks
+	IPFamilyV6   = "v6"   // IPv6 address, falling back to IPv4
+	IPFamilyDual = "dual" // Both addresses as separate upstreams
+)
+
+// HostConfig represents a Docker host to discover containers on
+type HostConfig struct {
+	Name     string     `json:"name"`     // Name shown in site comments
+	Endpoint string     `json:"endpoint"` // Docker endpoint, e.g. tcp://10.0.0.2:2376 or unix:///var/run/docker.sock
+	TLS      *TLSConfig `json:"tls"`      // Client certificates for tcp+TLS endpoints
+	Upstream string     `json:"upstream"` // "network" for the container IP on the network, "published" for the published port
+	Address  string     `json:"address"`  // Host IP used with published ports
+}
+
+// TLSConfig holds the paths of the TLS files for a Docker endpoint
+type TLSConfig struct {
+	CA   string `json:"ca"`
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// Supported host upstreams
+const (
+	HostUpstreamNetwork   = "network"   // Container IP on the monitored network, e.g. an overlay network
+	HostUpstreamPublished = "published" // Published port on the host address
+)
+
+// Supported output formats
+const (
+	FormatCaddyfile = "caddyfile"
+	FormatJSON      = "json"
+)
+
+// Supported Caddyfile layouts
+const (
+	LayoutHandle = "handle" // Host matchers with handle blocks, imported inside a site block
+	LayoutSite   = "site"   // One site block per host group
+)
+
+// Supported discovery modes
+const (
+	ModeContainer = "container" // Local containers attached to the network
+	ModeSwarm     = "swarm"     // Swarm services with labels on the service spec
+)
+
+// Supported swarm upstreams
+const (
+	SwarmEndpointVIP   = "vip"
+	SwarmEndpointTasks = "tasks"
+)
+
 // NotifyConfig represents the notification configuration
 type NotifyConfig struct {
-	ContainerID string   `json:"containerId"`
-	WorkingDir  string   `json:"workingDir"`
-	Command     []string `json:"command"`
+	ContainerID string          `json:"containerId"`
+	Label       string          `json:"label"`   // Also notify running containers with this label, e.g. caddy-gen.notify=true
+	Service     string          `json:"service"` // Also notify running containers of this compose service
+	Project     string          `json:"project"` // Compose project of the service, the project of caddy-gen if empty
+	Mode        string          `json:"mode"`    // "exec" to run the command, "signal" to send a signal, "restart" to restart
+	Signal      string          `json:"signal"`  // Signal sent in signal mode, required as Caddy itself reloads on none
+	WorkingDir  string          `json:"workingDir"`
+	Command     []string        `json:"command"`
+	Timeout     string          `json:"timeout"` // Maximum duration of notifying each container, e.g. 30s
+	Admin       *AdminConfig    `json:"admin"`
+	Webhooks    []WebhookConfig `json:"webhooks"`
+}
+
+// WebhookConfig represents an HTTP endpoint notified of config changes
+type WebhookConfig struct {
+	URL           string            `json:"url"`
+	Secret        string            `json:"secret"`        // Key of the HMAC-SHA256 signature of the body, unsigned if empty
+	Headers       map[string]string `json:"headers"`       // Extra request headers
+	Timeout       string            `json:"timeout"`       // Timeout of each attempt, e.g. 10s
+	Attempts      int               `json:"attempts"`      // Number of attempts, 3 if zero
+	IncludeConfig bool              `json:"includeConfig"` // Include the generated config in the body
+}
+
+// HasTargets reports whether containers are selected for notification
+func (n *NotifyConfig) HasTargets() bool {
+	return n.ContainerID != "" || n.Label != "" || n.Service != ""
 }
 
-// NewConfig creates a new Config instance with values from environment variables
-func NewConfig() *Config {
+// Supported notify modes
+const (
+	NotifyModeExec    = "exec"    // Execute the command in the containers
+	NotifyModeSignal  = "signal"  // Send a signal to the containers
+	NotifyModeRestart = "restart" // Restart the containers
+)
+
+// AdminConfig represents the configuration for pushing config through Caddy's admin API
+type AdminConfig struct {
+	Endpoints []string          `json:"endpoints"` // Admin addresses, e.g. http://caddy:2019 or unix//run/caddy/admin.sock
+	Mode      string            `json:"mode"`      // "load" to replace the full config, "patch" to replace the caddy-gen server only
+	ID        string            `json:"id"`        // @id of the caddy-gen server in patch mode
+	Headers   map[string]string `json:"headers"`   // Extra request headers, e.g. Authorization
+}
+
+// Supported admin API modes
+const (
+	AdminModeLoad  = "load"
+	AdminModePatch = "patch"
+)
+
+// NewConfig creates a new Config instance with values from environment variables. Choices are
+// kept as given and checked by Load once the config file and flags are applied.
+func NewConfig() (*Config, error) {
+	notify, err := ParseNotifyConfig(GetEnv("CADDY_GEN_NOTIFY", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CADDY_GEN_NOTIFY: %v", err)
+	}
+	hosts, err := ParseHostsConfig(GetEnv("CADDY_GEN_HOSTS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CADDY_GEN_HOSTS: %v", err)
+	}
+	published, err := ParseBool(GetEnv("CADDY_GEN_PUBLISHED", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CADDY_GEN_PUBLISHED: %v", err)
+	}
+	validate, err := ParseBool(GetEnv("CADDY_GEN_VALIDATE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CADDY_GEN_VALIDATE: %v", err)
+	}
+
 	return &Config{
-		Network: GetEnv("CADDY_GEN_NETWORK", "gateway"),
-		OutFile: GetEnv("CADDY_GEN_OUTFILE", "docker-sites.caddy"),
-		Notify:  ParseNotifyConfig(GetEnv("CADDY_GEN_NOTIFY", "")),
+		Networks:      ParseList(GetEnv("CADDY_GEN_NETWORK", "gateway")),
+		OutFile:       GetEnv("CADDY_GEN_OUTFILE", "docker-sites.caddy"),
+		Notify:        notify,
+		Format:        GetEnv("CADDY_GEN_FORMAT", FormatCaddyfile),
+		Layout:        GetEnv("CADDY_GEN_LAYOUT", LayoutHandle),
+		Mode:          GetEnv("CADDY_GEN_MODE", ModeContainer),
+		SwarmEndpoint: GetEnv("CADDY_GEN_SWARM_ENDPOINT", SwarmEndpointVIP),
+		Hosts:         hosts,
+		Health:        GetEnv("CADDY_GEN_HEALTH", HealthAuto),
+		Upstream:      GetEnv("CADDY_GEN_UPSTREAM", UpstreamIP),
+		Published:     published,
+		HostGateway:   GetEnv("CADDY_GEN_HOST_GATEWAY", "host.docker.internal"),
+		IPFamily:      GetEnv("CADDY_GEN_IP_FAMILY", IPFamilyV4),
+		Validate:      validate,
+		RejectedFile:  GetEnv("CADDY_GEN_REJECTED_FILE", ""),
+		StatusFile:    GetEnv("CADDY_GEN_STATUS_FILE", ""),
+	}, nil
+}
+
+// SelectNetworks returns the networks to try in order, restricted to the preferred one if set
+func (c *Config) SelectNetworks(preferred string) ([]string, error) {
+	preferred = strings.TrimSpace(preferred)
+	if preferred == "" {
+		return c.Networks, nil
+	}
+	for _, network := range c.Networks {
+		if network == preferred {
+			return []string{network}, nil
+		}
+	}
+	return nil, fmt.Errorf("network %s is not monitored", preferred)
+}
+
+// ParseList parses a comma separated list, skipping empty items
+func ParseList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
 
 // GetEnv gets an environment variable or returns a default value
@@ -37,17 +225,161 @@ func GetEnv(key, fallback string) string {
 	return fallback
 }
 
-// ParseNotifyConfig parses the notification configuration from a JSON string
-func ParseNotifyConfig(raw string) *NotifyConfig {
+// ParseNotifyConfig parses the notification configuration from a JSON string, rejecting unknown keys
+func ParseNotifyConfig(raw string) (*NotifyConfig, error) {
 	if raw == "" {
-		return nil
+		return nil, nil
 	}
 
 	var config NotifyConfig
-	err := json.Unmarshal([]byte(raw), &config)
+	if err := decodeJSON([]byte(raw), &config); err != nil {
+		return nil, err
+	}
+	mode, err := checkChoice("notify mode", config.Mode, NotifyModeExec, NotifyModeSignal, NotifyModeRestart)
 	if err != nil {
-		log.Printf("Failed to parse CADDY_GEN_NOTIFY: %v", err)
-		return nil
+		return nil, err
+	}
+	config.Mode = mode
+	return &config, nil
+}
+
+// ParseHostsConfig parses the Docker hosts from a JSON string, rejecting unknown keys
+func ParseHostsConfig(raw string) ([]HostConfig, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var hosts []HostConfig
+	if err := decodeJSON([]byte(raw), &hosts); err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		if hosts[i].Name == "" {
+			hosts[i].Name = hosts[i].Endpoint
+		}
+		upstream, err := checkChoice("upstream of host "+hosts[i].Name, hosts[i].Upstream, HostUpstreamNetwork, HostUpstreamPublished)
+		if err != nil {
+			return nil, err
+		}
+		hosts[i].Upstream = upstream
+	}
+	return hosts, nil
+}
+
+// decodeJSON decodes a JSON value, rejecting unknown keys and trailing data
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the JSON value")
 	}
-	return &config
-} 
\ No newline at end of file
+	// encoding/json matches keys case-insensitively, so check them against the tags first
+	if err := checkKeys(raw, reflect.TypeOf(v), ""); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// checkKeys reports the first key of a decoded JSON value that matches no json tag of the type
+func checkKeys(raw interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch value := raw.(type) {
+	case map[string]interface{}:
+		if t.Kind() == reflect.Map {
+			for key, item := range value {
+				if err := checkKeys(item, t.Elem(), path+key+"."); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for key, item := range value {
+			field, exists := fields[key]
+			if !exists {
+				return fmt.Errorf("unknown key %s%s", path, key)
+			}
+			if err := checkKeys(item, field, path+key+"."); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			for i, item := range value {
+				if err := checkKeys(item, t.Elem(), fmt.Sprintf("%s%d.", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ParseBool parses a boolean like "true", "1", "yes" or "on", rejecting unknown values
+func ParseBool(raw string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "", "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", raw)
+}
+
+// ParseHealth parses a readiness gating mode like "tcp" or "http:/healthz" into the mode and
+// the request path of HTTP probes
+func ParseHealth(raw string) (string, string, error) {
+	raw = strings.TrimSpace(raw)
+	mode, path, _ := strings.Cut(raw, ":")
+	mode = strings.ToLower(mode)
+
+	switch mode {
+	case "":
+		return HealthAuto, "", nil
+	case HealthAuto, HealthNone, HealthDocker, HealthTCP:
+		if path != "" {
+			return "", "", fmt.Errorf("health mode %s takes no path", mode)
+		}
+		return mode, "", nil
+	case HealthHTTP:
+		if path == "" {
+			path = "/"
+		}
+		if !strings.HasPrefix(path, "/") {
+			return "", "", fmt.Errorf("invalid health check path %s", path)
+		}
+		return mode, path, nil
+	}
+	return "", "", fmt.Errorf("unknown health mode %s", raw)
+}
+
+// checkChoice parses one of the allowed values, the first one if empty, rejecting unknown values
+func checkChoice(name, raw string, allowed ...string) (string, error) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	if value == "" {
+		return allowed[0], nil
+	}
+	for _, choice := range allowed {
+		if value == choice {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unknown %s %q, want one of %s", name, raw, strings.Join(allowed, ", "))
+}
@@ -9,12 +9,12 @@ func TestGetEnv(t *testing.T) {
 	// Test with existing environment variable
 	os.Setenv("TEST_ENV_VAR", "test_value")
 	defer os.Unsetenv("TEST_ENV_VAR")
-	
+
 	result := GetEnv("TEST_ENV_VAR", "default_value")
 	if result != "test_value" {
 		t.Errorf("GetEnv() = %s; want test_value", result)
 	}
-	
+
 	// Test with non-existing environment variable
 	result = GetEnv("NON_EXISTING_VAR", "default_value")
 	if result != "default_value" {
@@ -25,9 +25,9 @@ func TestGetEnv(t *testing.T) {
 func TestParseNotifyConfig(t *testing.T) {
 	// Test with valid JSON
 	validJSON := `{"containerId":"test-container","workingDir":"/app","command":["caddy","reload"]}`
-	config := ParseNotifyConfig(validJSON)
-	
-	if config == nil {
+	config, err := ParseNotifyConfig(validJSON)
+
+	if err != nil || config == nil {
 		t.Fatal("ParseNotifyConfig() returned nil for valid JSON")
 	}
 	if config.ContainerID != "test-container" {
@@ -39,23 +39,27 @@ func TestParseNotifyConfig(t *testing.T) {
 	if len(config.Command) != 2 || config.Command[0] != "caddy" || config.Command[1] != "reload" {
 		t.Errorf("config.Command = %v; want [caddy reload]", config.Command)
 	}
-	
+
 	// Test with empty string
-	config = ParseNotifyConfig("")
-	if config != nil {
-		t.Errorf("ParseNotifyConfig() = %v; want nil", config)
+	config, err = ParseNotifyConfig("")
+	if config != nil || err != nil {
+		t.Errorf("ParseNotifyConfig() = %v, %v; want nil", config, err)
 	}
-	
+
 	// Test with invalid JSON
-	config = ParseNotifyConfig("{invalid json}")
-	if config != nil {
-		t.Errorf("ParseNotifyConfig() = %v; want nil", config)
+	if _, err = ParseNotifyConfig("{invalid json}"); err == nil {
+		t.Error("ParseNotifyConfig() error = nil; want error for invalid JSON")
+	}
+
+	// Test with an unknown key
+	if _, err = ParseNotifyConfig(`{"containerID":"caddy"}`); err == nil {
+		t.Error("ParseNotifyConfig() error = nil; want error for unknown key")
 	}
 }
 
 func TestNewConfig(t *testing.T) {
 	// Set environment variables
-	os.Setenv("CADDY_GEN_NETWORK", "test-network")
+	os.Setenv("CADDY_GEN_NETWORK", "test-network, internal")
 	os.Setenv("CADDY_GEN_OUTFILE", "test-outfile")
 	os.Setenv("CADDY_GEN_NOTIFY", `{"containerId":"test-container","workingDir":"/app","command":["test"]}`)
 	defer func() {
@@ -63,11 +67,14 @@ func TestNewConfig(t *testing.T) {
 		os.Unsetenv("CADDY_GEN_OUTFILE")
 		os.Unsetenv("CADDY_GEN_NOTIFY")
 	}()
-	
-	config := NewConfig()
-	
-	if config.Network != "test-network" {
-		t.Errorf("config.Network = %s; want test-network", config.Network)
+
+	config, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	if len(config.Networks) != 2 || config.Networks[0] != "test-network" || config.Networks[1] != "internal" {
+		t.Errorf("config.Networks = %v; want [test-network internal]", config.Networks)
 	}
 	if config.OutFile != "test-outfile" {
 		t.Errorf("config.OutFile = %s; want test-outfile", config.OutFile)
@@ -78,4 +85,59 @@ func TestNewConfig(t *testing.T) {
 	if config.Notify.ContainerID != "test-container" {
 		t.Errorf("config.Notify.ContainerID = %s; want test-container", config.Notify.ContainerID)
 	}
-} 
\ No newline at end of file
+}
+
+func TestSelectNetworks(t *testing.T) {
+	config := &Config{Networks: []string{"public", "internal"}}
+
+	networks, err := config.SelectNetworks("")
+	if err != nil || len(networks) != 2 {
+		t.Errorf("SelectNetworks(\"\") = %v, %v; want all networks", networks, err)
+	}
+
+	networks, err = config.SelectNetworks("internal")
+	if err != nil || len(networks) != 1 || networks[0] != "internal" {
+		t.Errorf("SelectNetworks(internal) = %v, %v; want [internal]", networks, err)
+	}
+
+	if _, err := config.SelectNetworks("other"); err == nil {
+		t.Error("SelectNetworks(other) error = nil; want error for unmonitored network")
+	}
+}
+
+func TestParseHostsConfig(t *testing.T) {
+	hosts, err := ParseHostsConfig(`[{"endpoint":"tcp://10.0.0.2:2376","upstream":"published","address":"10.0.0.2","tls":{"ca":"ca.pem"}},{"name":"vm3","endpoint":"tcp://10.0.0.3:2376"}]`)
+	if err != nil || len(hosts) != 2 {
+		t.Fatalf("ParseHostsConfig() returned %d hosts, %v; want 2", len(hosts), err)
+	}
+	if hosts[0].Name != "tcp://10.0.0.2:2376" || hosts[0].Upstream != HostUpstreamPublished || hosts[0].TLS.CA != "ca.pem" {
+		t.Errorf("hosts[0] = %+v; want name from endpoint, published upstream and TLS", hosts[0])
+	}
+	if hosts[1].Name != "vm3" || hosts[1].Upstream != HostUpstreamNetwork {
+		t.Errorf("hosts[1] = %+v; want vm3 with network upstream", hosts[1])
+	}
+
+	if _, err := ParseHostsConfig("{invalid json}"); err == nil {
+		t.Error("ParseHostsConfig() error = nil; want error for invalid JSON")
+	}
+}
+
+func TestParseHealth(t *testing.T) {
+	tests := map[string][2]string{
+		"":             {HealthAuto, ""},
+		"TCP":          {HealthTCP, ""},
+		"http":         {HealthHTTP, "/"},
+		"http:/health": {HealthHTTP, "/health"},
+	}
+	for raw, want := range tests {
+		if mode, path, err := ParseHealth(raw); err != nil || mode != want[0] || path != want[1] {
+			t.Errorf("ParseHealth(%q) = %s, %s, %v; want %s, %s", raw, mode, path, err, want[0], want[1])
+		}
+	}
+
+	for _, raw := range []string{"htp", "http:healthz", "none:/x"} {
+		if _, _, err := ParseHealth(raw); err == nil {
+			t.Errorf("ParseHealth(%q) error = nil; want error", raw)
+		}
+	}
+}
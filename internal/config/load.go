@@ -0,0 +1,273 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// flagSetting is a command line flag overriding a setting
+type flagSetting struct {
+	name   string
+	usage  string
+	isBool bool
+	apply  func(c *Config, value string) error
+}
+
+// flagSettings lists the command line flags, named after the environment variables
+var flagSettings = []flagSetting{
+	{name: "network", usage: "Docker networks to monitor, separated by commas", apply: func(c *Config, value string) error {
+		c.Networks = ParseList(value)
+		return nil
+	}},
+	{name: "outfile", usage: "output file for Caddy configuration", apply: func(c *Config, value string) error {
+		c.OutFile = value
+		return nil
+	}},
+	{name: "notify", usage: "notification configuration as JSON", apply: func(c *Config, value string) (err error) {
+		c.Notify, err = ParseNotifyConfig(value)
+		return err
+	}},
+	{name: "format", usage: "output format, caddyfile or json", apply: func(c *Config, value string) error {
+		c.Format = value
+		return nil
+	}},
+	{name: "layout", usage: "Caddyfile layout, handle or site", apply: func(c *Config, value string) error {
+		c.Layout = value
+		return nil
+	}},
+	{name: "mode", usage: "discovery mode, container or swarm", apply: func(c *Config, value string) error {
+		c.Mode = value
+		return nil
+	}},
+	{name: "swarm-endpoint", usage: "upstream in swarm mode, vip or tasks", apply: func(c *Config, value string) error {
+		c.SwarmEndpoint = value
+		return nil
+	}},
+	{name: "hosts", usage: "Docker hosts to aggregate as JSON", apply: func(c *Config, value string) (err error) {
+		c.Hosts, err = ParseHostsConfig(value)
+		return err
+	}},
+	{name: "health", usage: "default readiness gating", apply: func(c *Config, value string) error {
+		c.Health = value
+		return nil
+	}},
+	{name: "upstream", usage: "default upstream addressing, ip, name, service or alias", apply: func(c *Config, value string) error {
+		c.Upstream = value
+		return nil
+	}},
+	{name: "published", usage: "include containers outside the monitored networks", isBool: true, apply: func(c *Config, value string) (err error) {
+		c.Published, err = ParseBool(value)
+		return err
+	}},
+	{name: "host-gateway", usage: "address of the Docker host as seen from Caddy", apply: func(c *Config, value string) error {
+		c.HostGateway = value
+		return nil
+	}},
+	{name: "ip-family", usage: "preferred IP family of upstreams, v4, v6 or dual", apply: func(c *Config, value string) error {
+		c.IPFamily = value
+		return nil
+	}},
+	{name: "validate", usage: "validate the generated Caddyfile before writing it", isBool: true, apply: func(c *Config, value string) (err error) {
+		c.Validate, err = ParseBool(value)
+		return err
+	}},
+	{name: "rejected-file", usage: "file to write rejected configs to", apply: func(c *Config, value string) error {
+		c.RejectedFile = value
+		return nil
+	}},
+	{name: "status-file", usage: "file to write the outcome of the last config change to", apply: func(c *Config, value string) error {
+		c.StatusFile = value
+		return nil
+	}},
+}
+
+// flagValue records a flag until the config file is loaded, so flags take precedence over it
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	if v.isBool {
+		if _, err := ParseBool(value); err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+	}
+	v.value = value
+	return nil
+}
+
+// IsBoolFlag allows boolean flags without a value, like --published
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// Load builds the config from the command line flags, the config file given by --config or
+// CADDY_GEN_CONFIG, and the environment variables, in this order of precedence. It returns
+// the arguments after the flags.
+func Load(name string, args []string, output io.Writer) (*Config, []string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	configFile := flags.String("config", GetEnv("CADDY_GEN_CONFIG", ""), "YAML or TOML config file")
+	settings := make(map[string]flagSetting)
+	for _, setting := range flagSettings {
+		settings[setting.name] = setting
+		flags.Var(&flagValue{isBool: setting.isBool}, setting.name, setting.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := NewConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if *configFile != "" {
+		if err := cfg.LoadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+		cfg.File = *configFile
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if setting, exists := settings[f.Name]; exists && err == nil {
+			if applyErr := setting.apply(cfg, f.Value.String()); applyErr != nil {
+				err = fmt.Errorf("invalid flag --%s: %v", f.Name, applyErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.check(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// LoadFile overrides the settings present in a YAML or TOML file, chosen by its extension.
+// Keys are the JSON names of the settings, like outFile, and unknown keys are rejected.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var raw map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("unsupported config file %s, want .yml, .yaml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if raw == nil {
+		return nil
+	}
+
+	// Decode through JSON so the file shares the keys and strictness of CADDY_GEN_NOTIFY
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(raw); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	var file Config
+	if err := decodeJSON(body.Bytes(), &file); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	// Settings present in the file replace the current ones whole, so notify and hosts are not
+	// merged with the environment
+	current, loaded := reflect.ValueOf(c).Elem(), reflect.ValueOf(&file).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		name, _, _ := strings.Cut(current.Type().Field(i).Tag.Get("json"), ",")
+		if _, exists := raw[name]; exists {
+			current.Field(i).Set(loaded.Field(i))
+		}
+	}
+	return nil
+}
+
+// check validates the merged settings, rejecting unknown choices from the config file and flags
+func (c *Config) check() error {
+	if len(c.Networks) == 0 {
+		return fmt.Errorf("no network to monitor")
+	}
+	if c.OutFile == "" {
+		return fmt.Errorf("no output file")
+	}
+
+	choices := []choiceSetting{
+		{"format", &c.Format, []string{FormatCaddyfile, FormatJSON}},
+		{"layout", &c.Layout, []string{LayoutHandle, LayoutSite}},
+		{"mode", &c.Mode, []string{ModeContainer, ModeSwarm}},
+		{"swarm endpoint", &c.SwarmEndpoint, []string{SwarmEndpointVIP, SwarmEndpointTasks}},
+		{"upstream", &c.Upstream, []string{UpstreamIP, UpstreamName, UpstreamService, UpstreamAlias}},
+		{"IP family", &c.IPFamily, []string{IPFamilyV4, IPFamilyV6, IPFamilyDual}},
+	}
+	if c.Notify != nil {
+		choices = append(choices, choiceSetting{"notify mode", &c.Notify.Mode,
+			[]string{NotifyModeExec, NotifyModeSignal, NotifyModeRestart}})
+	}
+	for i := range c.Hosts {
+		host := &c.Hosts[i]
+		if host.Name == "" {
+			host.Name = host.Endpoint
+		}
+		choices = append(choices, choiceSetting{"upstream of host " + host.Name, &host.Upstream,
+			[]string{HostUpstreamNetwork, HostUpstreamPublished}})
+	}
+
+	for _, choice := range choices {
+		value, err := checkChoice(choice.name, *choice.value, choice.allowed...)
+		if err != nil {
+			return err
+		}
+		*choice.value = value
+	}
+	// Caddy v2 does not reload on any signal, so signal mode only works with an explicit signal
+	// handled by a wrapper entrypoint
+	if c.Notify != nil && c.Notify.Mode == NotifyModeSignal && strings.TrimSpace(c.Notify.Signal) == "" {
+		return fmt.Errorf("notify mode signal requires a signal")
+	}
+	if c.Notify != nil && c.Notify.Timeout != "" {
+		if timeout, err := time.ParseDuration(c.Notify.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid notify timeout %q", c.Notify.Timeout)
+		}
+	}
+
+	// Health takes a mode and an optional path for HTTP probes, like http:/healthz
+	if _, _, err := ParseHealth(c.Health); err != nil {
+		return err
+	}
+	if c.Health = strings.TrimSpace(c.Health); c.Health == "" {
+		c.Health = HealthAuto
+	}
+	return nil
+}
+
+// choiceSetting is a setting restricted to some values
+type choiceSetting struct {
+	name    string
+	value   *string
+	allowed []string
+}
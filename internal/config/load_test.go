@@ -0,0 +1,203 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes a config file to a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"caddy-gen.yml": `
+networks: [public, internal]
+outFile: /data/sites.caddy
+layout: site
+published: true
+notify:
+  label: caddy-gen.notify=true
+  mode: signal
+  webhooks:
+    - url: https://deploy.example.com/hooks/caddy
+      attempts: 5
+`,
+		"caddy-gen.toml": `
+networks = ["public", "internal"]
+outFile = "/data/sites.caddy"
+layout = "site"
+published = true
+
+[notify]
+label = "caddy-gen.notify=true"
+mode = "signal"
+
+[[notify.webhooks]]
+url = "https://deploy.example.com/hooks/caddy"
+attempts = 5
+`,
+	}
+	for name, content := range files {
+		config := &Config{OutFile: "docker-sites.caddy", Format: FormatCaddyfile}
+		if err := config.LoadFile(writeConfigFile(t, name, content)); err != nil {
+			t.Fatalf("LoadFile(%s) error = %v", name, err)
+		}
+		if strings.Join(config.Networks, ",") != "public,internal" || config.OutFile != "/data/sites.caddy" ||
+			config.Layout != LayoutSite || !config.Published || config.Format != FormatCaddyfile {
+			t.Errorf("LoadFile(%s) = %+v; want settings from the file", name, config)
+		}
+		if config.Notify == nil || config.Notify.Label != "caddy-gen.notify=true" || config.Notify.Mode != NotifyModeSignal ||
+			len(config.Notify.Webhooks) != 1 || config.Notify.Webhooks[0].Attempts != 5 {
+			t.Errorf("LoadFile(%s).Notify = %+v; want label, signal mode and a webhook", name, config.Notify)
+		}
+	}
+
+	invalid := map[string]string{
+		"unknown.yml":        "outfile: sites.caddy\n",
+		"nested.yml":         "notify:\n  containerID: caddy\n",
+		"unknown.toml":       "[notify]\ncommmand = [\"caddy\", \"reload\"]\n",
+		"type.yml":           "published: maybe\n",
+		"syntax.toml":        "networks = [\n",
+		"caddy-gen.json":     "{}",
+		"missing/caddy.yaml": "",
+	}
+	for name, content := range invalid {
+		path := filepath.Join(t.TempDir(), name)
+		if !strings.HasPrefix(name, "missing/") {
+			path = writeConfigFile(t, name, content)
+		}
+		if err := (&Config{}).LoadFile(path); err == nil {
+			t.Errorf("LoadFile(%s) error = nil; want error", name)
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	os.Setenv("CADDY_GEN_OUTFILE", "env.caddy")
+	os.Setenv("CADDY_GEN_LAYOUT", "site")
+	os.Setenv("CADDY_GEN_FORMAT", "json")
+	defer func() {
+		os.Unsetenv("CADDY_GEN_OUTFILE")
+		os.Unsetenv("CADDY_GEN_LAYOUT")
+		os.Unsetenv("CADDY_GEN_FORMAT")
+	}()
+	path := writeConfigFile(t, "caddy-gen.yaml", "outFile: file.caddy\nformat: caddyfile\nvalidate: false\n")
+
+	config, args, err := Load("caddy-gen", []string{"--config", path, "--outfile", "flag.caddy", "--validate", "--published=yes", "example.com"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(args) != 1 || args[0] != "example.com" {
+		t.Errorf("Load() args = %v; want [example.com]", args)
+	}
+	if config.OutFile != "flag.caddy" {
+		t.Errorf("config.OutFile = %s; want flag.caddy from the flag", config.OutFile)
+	}
+	if !config.Validate {
+		t.Error("config.Validate = false; want true from the flag")
+	}
+	if !config.Published {
+		t.Error("config.Published = false; want true from --published=yes")
+	}
+	if config.Format != FormatCaddyfile {
+		t.Errorf("config.Format = %s; want caddyfile from the file", config.Format)
+	}
+	if config.Layout != LayoutSite {
+		t.Errorf("config.Layout = %s; want site from the environment", config.Layout)
+	}
+	if len(config.Networks) != 1 || config.Networks[0] != "gateway" {
+		t.Errorf("config.Networks = %v; want the default [gateway]", config.Networks)
+	}
+}
+
+func TestLoadFileReplacesSettings(t *testing.T) {
+	config := &Config{
+		OutFile: "env.caddy",
+		Notify:  &NotifyConfig{ContainerID: "old-caddy", Mode: NotifyModeRestart},
+		Hosts:   []HostConfig{{Name: "vm1", Endpoint: "tcp://a", Upstream: HostUpstreamPublished, Address: "10.0.0.1"}},
+	}
+	path := writeConfigFile(t, "caddy-gen.yml", `
+notify:
+  label: caddy-gen.notify=true
+  command: [caddy, reload]
+hosts:
+  - endpoint: tcp://b
+`)
+	if err := config.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	// Settings in the file are not merged with the environment, others are kept
+	if notify := config.Notify; notify.ContainerID != "" || notify.Mode != "" || notify.Label != "caddy-gen.notify=true" {
+		t.Errorf("config.Notify = %+v; want only the notify settings of the file", notify)
+	}
+	if len(config.Hosts) != 1 || config.Hosts[0] != (HostConfig{Endpoint: "tcp://b"}) {
+		t.Errorf("config.Hosts = %+v; want only the hosts of the file", config.Hosts)
+	}
+	if config.OutFile != "env.caddy" {
+		t.Errorf("config.OutFile = %s; want env.caddy kept", config.OutFile)
+	}
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	tests := [][]string{
+		{"--layout", "sites"},
+		{"--notify", `{"containerId":"caddy","mode":"signal"}`},
+		{"--health", "htp"},
+		{"--health", "http:healthz"},
+		{"--notify", "{invalid json}"},
+		{"--notify", `{"containerId":"caddy","timeout":"soon"}`},
+		{"--notify", `{"containerId":"caddy","timeout":"0s"}`},
+		{"--published=maybe"},
+		{"--network", ""},
+		{"--unknown"},
+		{"--config", writeConfigFile(t, "caddy-gen.yml", "mode: cluster\n")},
+		{"--config", writeConfigFile(t, "caddy-gen.yml", "health: tcp:/ready\n")},
+		{"--config", writeConfigFile(t, "caddy-gen.yml", "hosts:\n  - endpoint: tcp://10.0.0.2:2376\n    upstream: port\n")},
+	}
+	for _, args := range tests {
+		if _, _, err := Load("caddy-gen", args, io.Discard); err == nil {
+			t.Errorf("Load(%v) error = nil; want error", args)
+		}
+	}
+
+	os.Setenv("CADDY_GEN_NOTIFY", "{invalid json}")
+	defer os.Unsetenv("CADDY_GEN_NOTIFY")
+	if _, _, err := Load("caddy-gen", nil, io.Discard); err == nil {
+		t.Error("Load() error = nil; want error for invalid CADDY_GEN_NOTIFY")
+	}
+}
+
+func TestLoadRejectsInvalidEnvironment(t *testing.T) {
+	for key, value := range map[string]string{
+		"CADDY_GEN_LAYOUT":    "sites",
+		"CADDY_GEN_HEALTH":    "htp",
+		"CADDY_GEN_PUBLISHED": "maybe",
+		"CADDY_GEN_HOSTS":     `[{"endpoint":"tcp://10.0.0.2:2376","upstream":"port"}]`,
+		"CADDY_GEN_NOTIFY":    `{"containerId":"caddy","mode":"reload"}`,
+	} {
+		os.Setenv(key, value)
+		if _, _, err := Load("caddy-gen", nil, io.Discard); err == nil {
+			t.Errorf("Load() error = nil; want error for %s=%s", key, value)
+		}
+		os.Unsetenv(key)
+	}
+
+	// A flag overrides an invalid environment variable
+	os.Setenv("CADDY_GEN_LAYOUT", "sites")
+	defer os.Unsetenv("CADDY_GEN_LAYOUT")
+	config, _, err := Load("caddy-gen", []string{"--layout", "site"}, io.Discard)
+	if err != nil || config.Layout != LayoutSite {
+		t.Errorf("Load() = %v, %v; want the site layout from the flag", config, err)
+	}
+}
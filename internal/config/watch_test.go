@@ -0,0 +1,36 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	path := writeConfigFile(t, "caddy-gen.yml", "layout: site\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 10)
+	go WatchFile(ctx, path, 10*time.Millisecond, func() { changes <- struct{}{} })
+
+	// Rewriting the same content is not a change
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("layout: site\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(changes) != 0 {
+		t.Fatalf("WatchFile() reported %d changes; want none for the same content", len(changes))
+	}
+
+	if err := os.WriteFile(path, []byte("layout: handle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("WatchFile() reported no change; want one for new content")
+	}
+}
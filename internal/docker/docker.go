@@ -3,13 +3,12 @@ package docker
 import (
 	"context"
 	"fmt"
-	"log"
-	"time"
+	"strings"
+	"sync"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/api/types/events"
 	"github.com/gera2ld/caddy-gen/internal/config"
 )
 
@@ -17,152 +16,173 @@ import (
 type Client struct {
 	client *client.Client
 	config *config.Config
+	host   config.HostConfig
+
+	// excluded holds containers whose routes are withdrawn before they leave the container list
+	excluded   map[string]bool
+	excludedMu sync.Mutex
 }
 
-// NewClient creates a new Docker client
-func NewClient(cfg *config.Config) (*Client, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// NewClients creates a Docker client for each configured host, or for the local daemon if none
+func NewClients(cfg *config.Config) ([]*Client, error) {
+	if len(cfg.Hosts) == 0 {
+		dockerClient, err := NewClient(cfg, config.HostConfig{Upstream: config.HostUpstreamNetwork})
+		if err != nil {
+			return nil, err
+		}
+		return []*Client{dockerClient}, nil
+	}
+
+	var clients []*Client
+	for _, host := range cfg.Hosts {
+		dockerClient, err := NewClient(cfg, host)
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, fmt.Errorf("host %s: %v", host.Name, err)
+		}
+		clients = append(clients, dockerClient)
+	}
+	return clients, nil
+}
+
+// NewClient creates a new Docker client for a host, configured from the environment if it has no endpoint
+func NewClient(cfg *config.Config, host config.HostConfig) (*Client, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host.Endpoint != "" {
+		opts = append(opts, client.WithHost(host.Endpoint))
+	}
+	if host.TLS != nil {
+		opts = append(opts, client.WithTLSClientConfig(host.TLS.CA, host.TLS.Cert, host.TLS.Key))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Docker client: %v", err)
 	}
-	
+
 	return &Client{
-		client: cli,
-		config: cfg,
+		client:   cli,
+		config:   cfg,
+		host:     host,
+		excluded: make(map[string]bool),
 	}, nil
 }
 
+// Host returns the host configuration of the client
+func (c *Client) Host() config.HostConfig {
+	return c.host
+}
+
 // Close closes the Docker client
 func (c *Client) Close() error {
 	return c.client.Close()
 }
 
-// ListContainers lists containers in the specified network
+// ListContainers lists containers in the specified networks
 func (c *Client) ListContainers() ([]types.Container, error) {
 	ctx := context.Background()
-	
+
 	// Create filter for containers in the specified network
 	args := c.createNetworkFilter()
-	
+
 	// List containers
-	return c.client.ContainerList(ctx, types.ContainerListOptions{
+	containers, err := c.client.ContainerList(ctx, types.ContainerListOptions{
 		Filters: args,
 	})
+	if err != nil {
+		return nil, err
+	}
+	if c.host.Upstream == config.HostUpstreamPublished {
+		containers = filterRoutingLabels(containers)
+	}
+
+	// Add containers outside the networks, reachable through host networking or published ports
+	if c.config.Published && c.host.Upstream != config.HostUpstreamPublished {
+		containers, err = c.addLabeledContainers(ctx, containers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Drop containers that are going away
+	c.excludedMu.Lock()
+	defer c.excludedMu.Unlock()
+	result := containers[:0]
+	for _, container := range containers {
+		if !c.excluded[container.ID] {
+			result = append(result, container)
+		}
+	}
+	return result, nil
 }
 
-// createNetworkFilter creates a filter for containers in the specified network
-func (c *Client) createNetworkFilter() filters.Args {
+// addLabeledContainers adds containers with routing labels that are not in the list yet
+func (c *Client) addLabeledContainers(ctx context.Context, containers []types.Container) ([]types.Container, error) {
 	args := filters.NewArgs()
-	args.Add("network", c.config.Network)
 	args.Add("status", "created")
 	args.Add("status", "restarting")
 	args.Add("status", "running")
-	return args
-}
-
-// Notify notifies the Caddy container to reload
-func (c *Client) Notify() {
-	if c.config.Notify == nil {
-		return
-	}
-
-	log.Printf("Notify: %+v", c.config.Notify)
-	
-	ctx := context.Background()
-	
-	// Create and execute the command
-	c.executeCommand(ctx)
-}
-
-// executeCommand creates and executes a command in the container
-func (c *Client) executeCommand(ctx context.Context) {
-	// Create exec configuration
-	execConfig := c.createExecConfig()
-
-	// Create exec instance
-	resp, err := c.client.ContainerExecCreate(ctx, c.config.Notify.ContainerID, execConfig)
+	labeled, err := c.client.ContainerList(ctx, types.ContainerListOptions{
+		Filters: args,
+	})
 	if err != nil {
-		log.Printf("Failed to create exec: %v", err)
-		return
+		return nil, err
 	}
+	labeled = filterRoutingLabels(labeled)
 
-	// Start exec instance
-	err = c.client.ContainerExecStart(ctx, resp.ID, types.ExecStartCheck{})
-	if err != nil {
-		log.Printf("Failed to start exec: %v", err)
+	listed := make(map[string]bool)
+	for _, container := range containers {
+		listed[container.ID] = true
 	}
-}
-
-// createExecConfig creates an exec configuration for the container
-func (c *Client) createExecConfig() types.ExecConfig {
-	return types.ExecConfig{
-		Cmd:          c.config.Notify.Command,
-		WorkingDir:   c.config.Notify.WorkingDir,
-		AttachStdout: false,
-		AttachStderr: false,
-		Detach:       true,
+	for _, container := range labeled {
+		if !listed[container.ID] {
+			containers = append(containers, container)
+		}
 	}
+	return containers, nil
 }
 
-// WatchEvents watches for Docker events and calls the callback function
-func (c *Client) WatchEvents(callback func()) {
-	ctx := context.Background()
-	
-	// Create filter for container events
-	args := c.createEventFilter()
-	
-	// Create debounced callback function
-	debouncedCallback := debounce(callback, 1*time.Second)
-	
-	// Start watching events
-	c.watchEventLoop(ctx, args, debouncedCallback)
-}
-
-// createEventFilter creates a filter for container events
-func (c *Client) createEventFilter() filters.Args {
-	args := filters.NewArgs()
-	args.Add("type", "container")
-	args.Add("event", "start")
-	args.Add("event", "stop")
-	return args
-}
-
-// watchEventLoop watches for Docker events in a loop
-func (c *Client) watchEventLoop(ctx context.Context, args filters.Args, callback func()) {
-	for {
-		// Create message channel
-		messages, errs := c.client.Events(ctx, types.EventsOptions{
-			Filters: args,
-		})
-		
-		// Process events
-		c.processEvents(messages, errs, callback)
+// filterRoutingLabels keeps the containers with routing labels
+func filterRoutingLabels(containers []types.Container) []types.Container {
+	result := containers[:0]
+	for _, container := range containers {
+		if HasRoutingLabels(container.Labels) {
+			result = append(result, container)
+		}
 	}
+	return result
 }
 
-// processEvents processes Docker events
-func (c *Client) processEvents(messages <-chan events.Message, errs <-chan error, callback func()) {
-	for {
-		select {
-		case <-messages:
-			callback()
-		case err := <-errs:
-			if err != nil {
-				log.Printf("Error receiving events: %v", err)
-				time.Sleep(5 * time.Second) // Wait before reconnecting
-				return
-			}
+// HasRoutingLabels reports whether labels define bindings, either virtual.bind or indexed
+// labels like virtual.0.host
+func HasRoutingLabels(labels map[string]string) bool {
+	if _, exists := labels["virtual.bind"]; exists {
+		return true
+	}
+	for key := range labels {
+		rest, prefixed := strings.CutPrefix(key, "virtual.")
+		index, _, found := strings.Cut(rest, ".")
+		if prefixed && found && index != "" && strings.Trim(index, "0123456789") == "" {
+			return true
 		}
 	}
+	return false
 }
 
-// Debounce function to avoid multiple callbacks
-func debounce(f func(), delay time.Duration) func() {
-	var timer *time.Timer
-	return func() {
-		if timer != nil {
-			timer.Stop()
+// createNetworkFilter creates a filter for containers in any of the specified networks
+func (c *Client) createNetworkFilter() filters.Args {
+	args := filters.NewArgs()
+	// Published ports are reachable without a shared network, those containers are filtered
+	// by routing labels after listing
+	if c.host.Upstream != config.HostUpstreamPublished {
+		for _, network := range c.config.Networks {
+			args.Add("network", network)
 		}
-		timer = time.AfterFunc(delay, f)
 	}
-} 
\ No newline at end of file
+	args.Add("status", "created")
+	args.Add("status", "restarting")
+	args.Add("status", "running")
+	return args
+}
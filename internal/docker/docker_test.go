@@ -0,0 +1,23 @@
+package docker
+
+import "testing"
+
+func TestHasRoutingLabels(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"virtual.bind": "example.com"}, true},
+		{map[string]string{"virtual.0.host": "example.com"}, true},
+		{map[string]string{"virtual.12.proxy.header_up": "X-A a"}, true},
+		{map[string]string{"virtual.port": "80"}, false},
+		{map[string]string{"virtual.lb_policy": "first"}, false},
+		{map[string]string{"virtual.x.host": "example.com"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := HasRoutingLabels(tt.labels); got != tt.want {
+			t.Errorf("HasRoutingLabels(%v) = %v; want %v", tt.labels, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+// eventAction describes how an event affects the routes
+type eventAction int
+
+const (
+	actionIgnore    eventAction = iota // No effect on routes
+	actionDebounce                     // Reconcile after the debounce delay
+	actionImmediate                    // Reconcile right away
+	actionRemove                       // Withdraw the container's routes and reconcile right away
+	actionRestore                      // Allow the container's routes again and reconcile after the debounce delay
+)
+
+// terminatingSignals are the kill signals that stop a container, others like SIGHUP are used for reloads
+var terminatingSignals = map[string]bool{
+	"2": true, "3": true, "9": true, "15": true,
+	"SIGINT": true, "SIGQUIT": true, "SIGKILL": true, "SIGTERM": true,
+	"INT": true, "QUIT": true, "KILL": true, "TERM": true,
+}
+
+// WatchEvents watches for Docker events and calls the callback function until the context is done
+func (c *Client) WatchEvents(ctx context.Context, callback func()) {
+	// Create filter for container events
+	args := c.createEventFilter()
+
+	// Create debounced callback function
+	debounced := newDebouncer(callback, 1*time.Second)
+
+	// Tasks on other nodes are rescheduled without any event here
+	if c.watchesTasks() {
+		go c.pollTasks(ctx, debounced)
+	}
+
+	// Start watching events
+	c.watchEventLoop(ctx, args, debounced)
+}
+
+// taskPollInterval is the delay between resyncs of task upstreams in swarm tasks mode
+const taskPollInterval = 30 * time.Second
+
+// swarmServiceLabel is set by swarm on the containers of service tasks
+const swarmServiceLabel = "com.docker.swarm.service.id"
+
+// watchesTasks checks whether upstreams are the tasks of swarm services
+func (c *Client) watchesTasks() bool {
+	return c.config.Mode == config.ModeSwarm && c.config.SwarmEndpoint == config.SwarmEndpointTasks
+}
+
+// pollTasks triggers the callback periodically until the context is done
+func (c *Client) pollTasks(ctx context.Context, debounced *debouncer) {
+	ticker := time.NewTicker(taskPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			debounced.Trigger()
+		}
+	}
+}
+
+// createEventFilter creates a filter for container and network events, or service events in
+// swarm mode, with the container events of tasks on this node in tasks mode
+func (c *Client) createEventFilter() filters.Args {
+	args := filters.NewArgs()
+	if c.config.Mode == config.ModeSwarm {
+		args.Add("type", "service")
+		args.Add("event", "create")
+		args.Add("event", "update")
+		args.Add("event", "remove")
+		if c.watchesTasks() {
+			// Docker has no task events, task containers are replaced when tasks fail or restart
+			args.Add("type", "container")
+			for _, event := range []string{"start", "die", "destroy", "health_status"} {
+				args.Add("event", event)
+			}
+		}
+		return args
+	}
+
+	// A network filter would also drop container events, so network events are matched in classifyEvent
+	args.Add("type", "container")
+	args.Add("type", "network")
+	for _, event := range []string{
+		"start", "stop", "die", "kill", "pause", "unpause", "rename", "health_status", "destroy",
+		"connect", "disconnect",
+	} {
+		args.Add("event", event)
+	}
+	return args
+}
+
+// classifyEvent returns how an event affects the routes and the ID of the container it is about
+func (c *Client) classifyEvent(msg events.Message) (eventAction, string) {
+	switch msg.Type {
+	case events.ServiceEventType:
+		return actionDebounce, ""
+
+	case events.NetworkEventType:
+		if !c.isMonitoredNetwork(msg.Actor.Attributes["name"]) {
+			return actionIgnore, ""
+		}
+		containerID := msg.Actor.Attributes["container"]
+		if msg.Action == "disconnect" {
+			return actionImmediate, containerID
+		}
+		return actionDebounce, containerID
+
+	case events.ContainerEventType:
+		if c.config.Mode == config.ModeSwarm {
+			return classifyTaskEvent(msg), ""
+		}
+		containerID := msg.Actor.ID
+		switch msg.Action {
+		case "start", "unpause":
+			return actionRestore, containerID
+		case "stop", "die", "pause":
+			return actionRemove, containerID
+		case "kill":
+			if terminatingSignals[msg.Actor.Attributes["signal"]] {
+				return actionRemove, containerID
+			}
+			return actionIgnore, containerID
+		case "destroy":
+			return actionImmediate, containerID
+		case "rename", "health_status: healthy":
+			return actionDebounce, containerID
+		case "health_status: unhealthy":
+			return actionImmediate, containerID
+		}
+	}
+	return actionIgnore, ""
+}
+
+// classifyTaskEvent returns how an event of a container in swarm mode affects the routes, only
+// the containers of service tasks are routed
+func classifyTaskEvent(msg events.Message) eventAction {
+	if msg.Actor.Attributes[swarmServiceLabel] == "" {
+		return actionIgnore
+	}
+	switch msg.Action {
+	case "die", "destroy", "health_status: unhealthy":
+		return actionImmediate
+	case "start", "health_status: healthy":
+		return actionDebounce
+	}
+	return actionIgnore
+}
+
+// isMonitoredNetwork checks whether a network is one of the monitored networks
+func (c *Client) isMonitoredNetwork(name string) bool {
+	for _, network := range c.config.Networks {
+		if network == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleEvent applies an event to the excluded containers and triggers the callback
+func (c *Client) handleEvent(msg events.Message, debounced *debouncer) {
+	action, containerID := c.classifyEvent(msg)
+
+	switch action {
+	case actionIgnore:
+		return
+	case actionRemove:
+		c.setExcluded(containerID, true)
+	case actionRestore:
+		c.setExcluded(containerID, false)
+	case actionImmediate:
+		if msg.Action == "destroy" {
+			c.setExcluded(containerID, false)
+		}
+	}
+
+	if action == actionRemove || action == actionImmediate {
+		log.Printf("Event %s %s on %s, updating routes now", msg.Type, msg.Action, containerID)
+		debounced.Flush()
+		return
+	}
+	debounced.Trigger()
+}
+
+// setExcluded marks a container as withdrawn or allowed again
+func (c *Client) setExcluded(containerID string, excluded bool) {
+	if containerID == "" {
+		return
+	}
+	c.excludedMu.Lock()
+	defer c.excludedMu.Unlock()
+	if excluded {
+		c.excluded[containerID] = true
+	} else {
+		delete(c.excluded, containerID)
+	}
+}
+
+// watchEventLoop watches for Docker events in a loop, resubscribing from the last received
+// event after errors and reconciling once reconnected, as events may have been missed
+func (c *Client) watchEventLoop(ctx context.Context, args filters.Args, debounced *debouncer) {
+	var lastEvent time.Time
+	delay := minReconnectDelay
+	reconnecting := false
+
+	for {
+		options := types.EventsOptions{Filters: args}
+		if !lastEvent.IsZero() {
+			options.Since = eventsSince(lastEvent)
+		}
+
+		// Create message channel
+		messages, errs := c.client.Events(ctx, options)
+		if reconnecting {
+			log.Printf("Reconnected to Docker events on %s, resyncing", c.hostName())
+			debounced.Trigger()
+		}
+
+		// Process events
+		received, err := c.processEvents(ctx, messages, errs, debounced, &lastEvent)
+		if ctx.Err() != nil {
+			debounced.Stop()
+			return
+		}
+		if received {
+			delay = minReconnectDelay
+		}
+
+		log.Printf("Error receiving events from %s, reconnecting in %v: %v", c.hostName(), delay, err)
+		select {
+		case <-ctx.Done():
+			debounced.Stop()
+			return
+		case <-time.After(delay):
+		}
+		delay = nextReconnectDelay(delay)
+		reconnecting = true
+	}
+}
+
+// eventsSince formats a time for the since option of the events API, keeping nanoseconds so
+// the last received event is not replayed
+func eventsSince(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+// processEvents processes Docker events until the stream fails, and reports whether any event was received
+func (c *Client) processEvents(ctx context.Context, messages <-chan events.Message, errs <-chan error, debounced *debouncer, lastEvent *time.Time) (bool, error) {
+	received := false
+	for {
+		select {
+		case <-ctx.Done():
+			return received, ctx.Err()
+		case msg := <-messages:
+			received = true
+			if msg.TimeNano != 0 {
+				*lastEvent = time.Unix(0, msg.TimeNano)
+			}
+			c.handleEvent(msg, debounced)
+		case err := <-errs:
+			if err != nil {
+				return received, err
+			}
+		}
+	}
+}
+
+// Reconnect delays for the event stream
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 1 * time.Minute
+)
+
+// nextReconnectDelay doubles the reconnect delay up to the maximum
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxReconnectDelay {
+		return maxReconnectDelay
+	}
+	return delay
+}
+
+// hostName returns a name of the Docker host for logging
+func (c *Client) hostName() string {
+	if c.host.Name == "" {
+		return "local host"
+	}
+	return c.host.Name
+}
+
+// debouncer delays a callback to avoid multiple calls, unless flushed
+type debouncer struct {
+	f     func()
+	delay time.Duration
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+// newDebouncer creates a new debouncer
+func newDebouncer(f func(), delay time.Duration) *debouncer {
+	return &debouncer{f: f, delay: delay}
+}
+
+// Trigger schedules the callback after the delay, replacing a pending call
+func (d *debouncer) Trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.delay, d.f)
+}
+
+// Flush cancels a pending call and runs the callback right away
+func (d *debouncer) Flush() {
+	d.Stop()
+	d.f()
+}
+
+// Stop cancels a pending call
+func (d *debouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
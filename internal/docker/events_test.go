@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+func TestClassifyEvent(t *testing.T) {
+	c := &Client{config: &config.Config{Networks: []string{"gateway"}}, excluded: make(map[string]bool)}
+
+	tests := []struct {
+		msg    events.Message
+		action eventAction
+	}{
+		{events.Message{Type: events.ContainerEventType, Action: "start"}, actionRestore},
+		{events.Message{Type: events.ContainerEventType, Action: "die"}, actionRemove},
+		{events.Message{Type: events.ContainerEventType, Action: "kill", Actor: events.Actor{Attributes: map[string]string{"signal": "15"}}}, actionRemove},
+		{events.Message{Type: events.ContainerEventType, Action: "kill", Actor: events.Actor{Attributes: map[string]string{"signal": "1"}}}, actionIgnore},
+		{events.Message{Type: events.ContainerEventType, Action: "pause"}, actionRemove},
+		{events.Message{Type: events.ContainerEventType, Action: "unpause"}, actionRestore},
+		{events.Message{Type: events.ContainerEventType, Action: "rename"}, actionDebounce},
+		{events.Message{Type: events.ContainerEventType, Action: "destroy"}, actionImmediate},
+		{events.Message{Type: events.ContainerEventType, Action: "health_status: healthy"}, actionDebounce},
+		{events.Message{Type: events.ContainerEventType, Action: "health_status: unhealthy"}, actionImmediate},
+		{events.Message{Type: events.ContainerEventType, Action: "health_status: starting"}, actionIgnore},
+		{events.Message{Type: events.NetworkEventType, Action: "connect", Actor: events.Actor{Attributes: map[string]string{"name": "gateway"}}}, actionDebounce},
+		{events.Message{Type: events.NetworkEventType, Action: "disconnect", Actor: events.Actor{Attributes: map[string]string{"name": "gateway"}}}, actionImmediate},
+		{events.Message{Type: events.NetworkEventType, Action: "disconnect", Actor: events.Actor{Attributes: map[string]string{"name": "other"}}}, actionIgnore},
+	}
+
+	for _, test := range tests {
+		if action, _ := c.classifyEvent(test.msg); action != test.action {
+			t.Errorf("classifyEvent(%s %s) = %d; want %d", test.msg.Type, test.msg.Action, action, test.action)
+		}
+	}
+}
+
+func TestClassifyTaskEvent(t *testing.T) {
+	c := &Client{config: &config.Config{Mode: config.ModeSwarm, SwarmEndpoint: config.SwarmEndpointTasks}}
+	task := events.Actor{Attributes: map[string]string{swarmServiceLabel: "abc"}}
+
+	tests := []struct {
+		msg    events.Message
+		action eventAction
+	}{
+		{events.Message{Type: events.ServiceEventType, Action: "update"}, actionDebounce},
+		{events.Message{Type: events.ContainerEventType, Action: "start", Actor: task}, actionDebounce},
+		{events.Message{Type: events.ContainerEventType, Action: "die", Actor: task}, actionImmediate},
+		{events.Message{Type: events.ContainerEventType, Action: "health_status: unhealthy", Actor: task}, actionImmediate},
+		{events.Message{Type: events.ContainerEventType, Action: "die"}, actionIgnore},
+	}
+	for _, test := range tests {
+		if action, _ := c.classifyEvent(test.msg); action != test.action {
+			t.Errorf("classifyEvent(%s %s) = %d; want %d", test.msg.Type, test.msg.Action, action, test.action)
+		}
+	}
+
+	if types := c.createEventFilter().Get("type"); len(types) != 2 {
+		t.Errorf("createEventFilter() types = %v; want service and container events in tasks mode", types)
+	}
+	c.config.SwarmEndpoint = config.SwarmEndpointVIP
+	if types := c.createEventFilter().Get("type"); len(types) != 1 {
+		t.Errorf("createEventFilter() types = %v; want only service events in vip mode", types)
+	}
+}
+
+func TestHandleEventExcludesContainers(t *testing.T) {
+	c := &Client{config: &config.Config{Networks: []string{"gateway"}}, excluded: make(map[string]bool)}
+	calls := 0
+	debounced := newDebouncer(func() { calls++ }, time.Hour)
+
+	kill := events.Message{Type: events.ContainerEventType, Action: "kill", Actor: events.Actor{ID: "abc", Attributes: map[string]string{"signal": "SIGKILL"}}}
+	c.handleEvent(kill, debounced)
+	if !c.excluded["abc"] || calls != 1 {
+		t.Errorf("after kill: excluded = %v, calls = %d; want excluded and immediate callback", c.excluded, calls)
+	}
+
+	start := events.Message{Type: events.ContainerEventType, Action: "start", Actor: events.Actor{ID: "abc"}}
+	c.handleEvent(start, debounced)
+	debounced.Stop()
+	if c.excluded["abc"] {
+		t.Errorf("after start: excluded = %v; want container allowed again", c.excluded)
+	}
+}
+
+func TestNextReconnectDelay(t *testing.T) {
+	var delays []time.Duration
+	for delay := minReconnectDelay; len(delays) < 9; delay = nextReconnectDelay(delay) {
+		delays = append(delays, delay)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		32 * time.Second, time.Minute, time.Minute, time.Minute}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("delays = %v; want %v", delays, want)
+			break
+		}
+	}
+}
+
+func TestEventsSince(t *testing.T) {
+	tests := map[time.Time]string{
+		time.Unix(1700000000, 0):          "1700000000.000000000",
+		time.Unix(1700000000, 5):          "1700000000.000000005",
+		time.Unix(0, 1700000000123456789): "1700000000.123456789",
+	}
+	for input, want := range tests {
+		if got := eventsSince(input); got != want {
+			t.Errorf("eventsSince(%d) = %s; want %s", input.UnixNano(), got, want)
+		}
+	}
+}
+
+func TestProcessEvents(t *testing.T) {
+	c := &Client{config: &config.Config{Networks: []string{"gateway"}}, excluded: make(map[string]bool)}
+	debounced := newDebouncer(func() {}, time.Hour)
+	defer debounced.Stop()
+
+	messages := make(chan events.Message)
+	errs := make(chan error)
+	go func() {
+		messages <- events.Message{Type: events.ContainerEventType, Action: "start", Actor: events.Actor{ID: "abc"}, TimeNano: 1700000000123456789}
+		errs <- errors.New("connection reset")
+	}()
+
+	// The stream error ends processing, remembering the last event to resubscribe from
+	var lastEvent time.Time
+	received, err := c.processEvents(context.Background(), messages, errs, debounced, &lastEvent)
+	if !received || err == nil || lastEvent.UnixNano() != 1700000000123456789 {
+		t.Errorf("processEvents() = %v, %v, last event %v; want received, the error and the event time", received, err, lastEvent)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lastEvent = time.Time{}
+	received, err = c.processEvents(ctx, messages, errs, debounced, &lastEvent)
+	if received || err != context.Canceled || !lastEvent.IsZero() {
+		t.Errorf("processEvents() = %v, %v; want nothing received and the context error", received, err)
+	}
+}
@@ -0,0 +1,285 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+// defaultExecTimeout bounds the notification of each container if the configuration sets no timeout
+const defaultExecTimeout = 30 * time.Second
+
+// Compose labels of a container
+const (
+	composeServiceLabel = "com.docker.compose.service"
+	composeProjectLabel = "com.docker.compose.project"
+)
+
+// ExecError is a notify command that failed or did not finish in time, with its output
+type ExecError struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Err      error // Set if the command could not be run or waited for
+}
+
+func (e *ExecError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("notify command failed: %v", e.Err)
+	}
+	output := strings.TrimSpace(e.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(e.Stdout)
+	}
+	return fmt.Sprintf("notify command exited with code %d: %s", e.ExitCode, output)
+}
+
+// NotifyResult is the outcome of notifying one container
+type NotifyResult struct {
+	Container string
+	Err       error
+}
+
+// NotifyError reports the containers that could not be notified
+type NotifyError struct {
+	Results []NotifyResult // Results of all targets, including the successful ones
+}
+
+func (e *NotifyError) Error() string {
+	var failures []string
+	for _, result := range e.Results {
+		if result.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", result.Container, result.Err))
+		}
+	}
+	return fmt.Sprintf("failed to notify %d of %d containers: %s", len(failures), len(e.Results), strings.Join(failures, "; "))
+}
+
+// Notify notifies the Caddy containers to reload, by executing a command in them, sending them
+// a signal or restarting them, and reports the containers that failed
+func (c *Client) Notify(content string) error {
+	if c.config.Notify == nil || !c.config.Notify.HasTargets() {
+		return nil
+	}
+
+	log.Printf("Notify: %+v", c.config.Notify)
+
+	timeout := defaultExecTimeout
+	if raw := c.config.Notify.Timeout; raw != "" {
+		var err error
+		if timeout, err = time.ParseDuration(raw); err != nil {
+			return fmt.Errorf("invalid notify timeout %s: %v", raw, err)
+		}
+	}
+
+	ctx := context.Background()
+	targets, err := c.notifyTargets(ctx)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		log.Printf("No running containers match the notify targets")
+		return nil
+	}
+
+	var results []NotifyResult
+	failed := false
+	for _, target := range targets {
+		err := c.notifyContainer(ctx, target, timeout)
+		if err != nil {
+			log.Printf("Failed to notify %s: %v", target, err)
+			failed = true
+		} else {
+			log.Printf("Notified %s", target)
+		}
+		results = append(results, NotifyResult{Container: target, Err: err})
+	}
+
+	if failed {
+		return &NotifyError{Results: results}
+	}
+	return nil
+}
+
+// notifyTargets returns the configured container and the running containers matching the
+// label and compose service
+func (c *Client) notifyTargets(ctx context.Context) ([]string, error) {
+	notifyConfig := c.config.Notify
+	var targets []string
+	seen := make(map[string]bool)
+	if notifyConfig.ContainerID != "" {
+		targets = append(targets, notifyConfig.ContainerID)
+		seen[notifyConfig.ContainerID] = true
+	}
+	if notifyConfig.Label == "" && notifyConfig.Service == "" {
+		return targets, nil
+	}
+
+	args := filters.NewArgs()
+	args.Add("status", "running")
+	if notifyConfig.Label != "" {
+		args.Add("label", notifyConfig.Label)
+	}
+	if notifyConfig.Service != "" {
+		// Other compose projects on the host may have a service of the same name
+		project, err := c.composeProject(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args.Add("label", composeServiceLabel+"="+notifyConfig.Service)
+		args.Add("label", composeProjectLabel+"="+project)
+	}
+	containers, err := c.client.ContainerList(ctx, types.ContainerListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notify targets: %v", err)
+	}
+
+	for _, item := range containers {
+		name := strings.TrimPrefix(item.Names[0], "/")
+		if seen[name] || seen[item.ID] {
+			continue
+		}
+		seen[name] = true
+		targets = append(targets, name)
+	}
+	return targets, nil
+}
+
+// composeProject returns the compose project of the notified service, from the configuration or
+// the project of the caddy-gen container itself, whose hostname is its container ID by default
+func (c *Client) composeProject(ctx context.Context) (string, error) {
+	if project := c.config.Notify.Project; project != "" {
+		return project, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the compose project of service %s, set project: %v", c.config.Notify.Service, err)
+	}
+	info, err := c.client.ContainerInspect(ctx, hostname)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the compose project of service %s, set project: %v", c.config.Notify.Service, err)
+	}
+	if info.Config == nil || info.Config.Labels[composeProjectLabel] == "" {
+		return "", fmt.Errorf("caddy-gen is not part of a compose project, set project of service %s", c.config.Notify.Service)
+	}
+	return info.Config.Labels[composeProjectLabel], nil
+}
+
+// notifyContainer notifies one container in the configured mode
+func (c *Client) notifyContainer(ctx context.Context, target string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch c.config.Notify.Mode {
+	case config.NotifyModeSignal:
+		// Caddy itself does not reload on signals, so there is no default that would do anything
+		signal := c.config.Notify.Signal
+		if signal == "" {
+			return fmt.Errorf("no signal configured for signal mode")
+		}
+		if err := c.client.ContainerKill(ctx, target, signal); err != nil {
+			return fmt.Errorf("failed to send %s: %v", signal, err)
+		}
+		return nil
+
+	case config.NotifyModeRestart:
+		if err := c.client.ContainerRestart(ctx, target, container.StopOptions{}); err != nil {
+			return fmt.Errorf("failed to restart: %v", err)
+		}
+		return nil
+
+	default:
+		stdout, err := c.executeCommand(ctx, target)
+		if err != nil {
+			return err
+		}
+		if output := strings.TrimSpace(stdout); output != "" {
+			log.Printf("Notify command output of %s: %s", target, output)
+		}
+		return nil
+	}
+}
+
+// executeCommand executes a command in the container, waits for it and returns its output
+func (c *Client) executeCommand(ctx context.Context, target string) (string, error) {
+	// Create exec configuration
+	execConfig := c.createExecConfig()
+
+	// Create exec instance
+	resp, err := c.client.ContainerExecCreate(ctx, target, execConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to create exec: %v", err)
+	}
+
+	// Attaching starts the exec instance
+	attach, err := c.client.ContainerExecAttach(ctx, resp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", fmt.Errorf("failed to start exec: %v", err)
+	}
+	defer attach.Close()
+
+	// Capture the output until the command exits
+	var stdout, stderr bytes.Buffer
+	copied := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(&stdout, &stderr, attach.Reader)
+		copied <- err
+	}()
+	select {
+	case err := <-copied:
+		if err != nil {
+			return "", &ExecError{Stdout: stdout.String(), Stderr: stderr.String(), Err: err}
+		}
+	case <-ctx.Done():
+		return "", &ExecError{Err: fmt.Errorf("timed out: %v", ctx.Err())}
+	}
+
+	exitCode, err := c.waitExec(ctx, resp.ID)
+	if err != nil {
+		return "", &ExecError{Stdout: stdout.String(), Stderr: stderr.String(), Err: err}
+	}
+	if exitCode != 0 {
+		return "", &ExecError{ExitCode: exitCode, Stdout: stdout.String(), Stderr: stderr.String()}
+	}
+	return stdout.String(), nil
+}
+
+// waitExec waits for an exec instance to stop running and returns its exit code
+func (c *Client) waitExec(ctx context.Context, execID string) (int, error) {
+	for {
+		inspect, err := c.client.ContainerExecInspect(ctx, execID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect exec: %v", err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		// The output may end slightly before the exit code is recorded
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return 0, fmt.Errorf("timed out: %v", ctx.Err())
+		}
+	}
+}
+
+// createExecConfig creates an exec configuration for the container
+func (c *Client) createExecConfig() types.ExecConfig {
+	return types.ExecConfig{
+		Cmd:          c.config.Notify.Command,
+		WorkingDir:   c.config.Notify.WorkingDir,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+}
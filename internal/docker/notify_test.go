@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+func TestNotifySignal(t *testing.T) {
+	var mu sync.Mutex
+	var listFilters string
+	killed := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			listFilters = r.URL.Query().Get("filters")
+			json.NewEncoder(w).Encode([]types.Container{
+				{ID: "aaa", Names: []string{"/caddy-1"}},
+				{ID: "bbb", Names: []string{"/caddy-2"}},
+				{ID: "ccc", Names: []string{"/static"}},
+			})
+		case strings.HasSuffix(r.URL.Path, "/kill"):
+			parts := strings.Split(r.URL.Path, "/")
+			name := parts[len(parts)-2]
+			if name == "caddy-2" {
+				http.Error(w, `{"message":"container is not running"}`, http.StatusConflict)
+				return
+			}
+			killed[name] = r.URL.Query().Get("signal")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.43"))
+	if err != nil {
+		t.Fatalf("NewClientWithOpts() error = %v", err)
+	}
+	c := &Client{client: cli, config: &config.Config{Notify: &config.NotifyConfig{
+		ContainerID: "static",
+		Label:       "caddy-gen.notify=true",
+		Mode:        config.NotifyModeSignal,
+		Signal:      "SIGUSR1",
+	}}}
+
+	err = c.Notify("")
+	var notifyErr *NotifyError
+	if !errors.As(err, &notifyErr) {
+		t.Fatalf("Notify() error = %v; want *NotifyError", err)
+	}
+
+	// Each target is reported, the configured container is not notified twice
+	var containers []string
+	for _, result := range notifyErr.Results {
+		containers = append(containers, result.Container)
+	}
+	if strings.Join(containers, ",") != "static,caddy-1,caddy-2" || notifyErr.Results[2].Err == nil || notifyErr.Results[1].Err != nil {
+		t.Errorf("Notify() results = %+v; want static and caddy-1 notified, caddy-2 failed", notifyErr.Results)
+	}
+	if killed["static"] != "SIGUSR1" || killed["caddy-1"] != "SIGUSR1" {
+		t.Errorf("killed = %v; want SIGUSR1 sent to static and caddy-1", killed)
+	}
+	if !strings.Contains(listFilters, "caddy-gen.notify=true") {
+		t.Errorf("filters = %s; want the notify label", listFilters)
+	}
+}
+
+func TestNotifyTargetsComposeProject(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip("no hostname")
+	}
+	var listFilters string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			listFilters = r.URL.Query().Get("filters")
+			json.NewEncoder(w).Encode([]types.Container{{ID: "aaa", Names: []string{"/proxy-caddy-1"}}})
+		case strings.HasSuffix(r.URL.Path, "/containers/"+hostname+"/json"):
+			json.NewEncoder(w).Encode(types.ContainerJSON{Config: &container.Config{
+				Labels: map[string]string{composeProjectLabel: "proxy"},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.43"))
+	if err != nil {
+		t.Fatalf("NewClientWithOpts() error = %v", err)
+	}
+	c := &Client{client: cli, config: &config.Config{Notify: &config.NotifyConfig{Service: "caddy"}}}
+
+	// The project of the caddy-gen container is used by default
+	targets, err := c.notifyTargets(context.Background())
+	if err != nil || len(targets) != 1 || targets[0] != "proxy-caddy-1" {
+		t.Errorf("notifyTargets() = %v, %v; want [proxy-caddy-1]", targets, err)
+	}
+	if !strings.Contains(listFilters, composeServiceLabel+"=caddy") || !strings.Contains(listFilters, composeProjectLabel+"=proxy") {
+		t.Errorf("filters = %s; want the service and project labels", listFilters)
+	}
+
+	// A configured project takes precedence
+	c.config.Notify.Project = "edge"
+	if _, err := c.notifyTargets(context.Background()); err != nil || !strings.Contains(listFilters, composeProjectLabel+"=edge") {
+		t.Errorf("filters = %s, %v; want the configured project", listFilters, err)
+	}
+}
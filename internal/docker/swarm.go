@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+// ServiceInfo is a swarm service with the addresses to proxy to
+type ServiceInfo struct {
+	Service   swarm.Service
+	Addresses []string
+	Err       error // Why the addresses could not be resolved, such as an invalid virtual.network
+}
+
+// ListServices lists swarm services with routing labels and resolves their addresses on the networks,
+// a service whose addresses cannot be resolved is returned with the error
+func (c *Client) ListServices() ([]ServiceInfo, error) {
+	ctx := context.Background()
+
+	networkIDs, err := c.networkIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := c.client.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ServiceInfo
+	for _, service := range services {
+		if !HasRoutingLabels(service.Spec.Labels) {
+			continue
+		}
+		addresses, err := c.serviceAddresses(ctx, service, networkIDs)
+		result = append(result, ServiceInfo{Service: service, Addresses: addresses, Err: err})
+	}
+	return result, nil
+}
+
+// networkIDs resolves the IDs of the monitored networks by name
+func (c *Client) networkIDs(ctx context.Context) (map[string]string, error) {
+	args := filters.NewArgs()
+	for _, network := range c.config.Networks {
+		args.Add("name", network)
+	}
+	networks, err := c.client.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %v", err)
+	}
+
+	// The name filter matches substrings, so look for exact matches
+	ids := make(map[string]string)
+	for _, network := range networks {
+		for _, name := range c.config.Networks {
+			if network.Name == name {
+				ids[name] = network.ID
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("networks %v not found", c.config.Networks)
+	}
+	return ids, nil
+}
+
+// serviceAddresses returns the VIP or the running task IPs of a service on the first matching network
+func (c *Client) serviceAddresses(ctx context.Context, service swarm.Service, networkIDs map[string]string) ([]string, error) {
+	networks, err := c.config.SelectNetworks(service.Spec.Labels["virtual.network"])
+	if err != nil {
+		return nil, err
+	}
+
+	if c.config.SwarmEndpoint != config.SwarmEndpointTasks {
+		for _, name := range networks {
+			for _, vip := range service.Endpoint.VirtualIPs {
+				if vip.NetworkID == networkIDs[name] {
+					return []string{stripCIDR(vip.Addr)}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("no VIP on networks %v", networks)
+	}
+
+	args := filters.NewArgs()
+	args.Add("service", service.ID)
+	args.Add("desired-state", "running")
+	tasks, err := c.client.TaskList(ctx, types.TaskListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %v", err)
+	}
+
+	for _, name := range networks {
+		var addresses []string
+		for _, task := range tasks {
+			if task.Status.State != swarm.TaskStateRunning {
+				continue
+			}
+			for _, attachment := range task.NetworksAttachments {
+				if attachment.Network.ID == networkIDs[name] && len(attachment.Addresses) > 0 {
+					addresses = append(addresses, stripCIDR(attachment.Addresses[0]))
+				}
+			}
+		}
+		if len(addresses) > 0 {
+			return addresses, nil
+		}
+	}
+	return nil, nil
+}
+
+// stripCIDR removes the prefix length from an address like 10.0.0.5/24
+func stripCIDR(addr string) string {
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		return addr[:i]
+	}
+	return addr
+}
@@ -0,0 +1,218 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gera2ld/caddy-gen/internal/caddyfile"
+)
+
+// bindError is a syntax error in a virtual.bind label
+type bindError struct {
+	binding int // Index of the binding in the label, counted from 1
+	column  int // Column in the label, counted from 1
+	msg     string
+}
+
+func (e *bindError) Error() string {
+	return fmt.Sprintf("binding %d, column %d: %s", e.binding, e.column, e.msg)
+}
+
+// bindSegment is the hostnames part or a directive of a binding, with escapes resolved
+type bindSegment struct {
+	text  string
+	cols  []int // Column in the label of each byte of text
+	start int   // Column in the label where the segment starts
+}
+
+// col returns the column of the byte at offset i of the segment
+func (s bindSegment) col(i int) int {
+	if i < len(s.cols) {
+		return s.cols[i]
+	}
+	return s.start
+}
+
+// bindBinding is one binding of a virtual.bind label
+type bindBinding struct {
+	index    int           // Index of the binding in the label, counted from 1
+	segments []bindSegment // Hostnames part followed by the directives
+}
+
+// lexBind splits a virtual.bind label into bindings on ";" and into segments on "|".
+// Separators inside quotes or {} blocks are literal, and "\;" and "\|" escape them outside quotes.
+// Other backslash escapes are kept for Caddy. On errors, the bindings before the broken one are returned.
+func lexBind(label string) ([]bindBinding, error) {
+	var bindings []bindBinding
+	var segments []bindSegment
+	var text []byte
+	var cols, braces []int
+	var quote byte
+	index, start, quoteCol := 1, 1, 0
+
+	emit := func(ch byte, col int) {
+		text = append(text, ch)
+		cols = append(cols, col)
+	}
+	endSegment := func(next int) {
+		segments = append(segments, bindSegment{text: string(text), cols: cols, start: start})
+		text, cols, start = nil, nil, next
+	}
+	endBinding := func(next int) {
+		endSegment(next)
+		// Empty bindings, e.g. after a trailing semicolon, are skipped
+		if len(segments) > 1 || strings.TrimSpace(segments[0].text) != "" {
+			bindings = append(bindings, bindBinding{index: index, segments: segments})
+		}
+		segments = nil
+		index++
+	}
+	fail := func(col int, format string, args ...interface{}) ([]bindBinding, error) {
+		return bindings, &bindError{binding: index, column: col, msg: fmt.Sprintf(format, args...)}
+	}
+
+	for i := 0; i < len(label); i++ {
+		ch, col := label[i], i+1
+		switch {
+		case quote != 0:
+			emit(ch, col)
+			if ch == '\\' && quote == '"' && i+1 < len(label) {
+				emit(label[i+1], col+1)
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\\' && i+1 < len(label):
+			next := label[i+1]
+			if next != ';' && next != '|' {
+				emit(ch, col)
+			}
+			emit(next, col+1)
+			i++
+		case ch == '"' || ch == '`':
+			quote, quoteCol = ch, col
+			emit(ch, col)
+		case ch == '{':
+			braces = append(braces, col)
+			emit(ch, col)
+		case ch == '}':
+			if len(braces) == 0 {
+				return fail(col, "unexpected }")
+			}
+			braces = braces[:len(braces)-1]
+			emit(ch, col)
+		case len(braces) > 0:
+			emit(ch, col)
+		case ch == ';':
+			endBinding(col + 1)
+		case ch == '|':
+			endSegment(col + 1)
+		default:
+			emit(ch, col)
+		}
+	}
+
+	if quote != 0 {
+		return fail(quoteCol, "unterminated quote %c", quote)
+	}
+	if len(braces) > 0 {
+		return fail(braces[0], "unclosed {")
+	}
+	endBinding(len(label) + 1)
+	return bindings, nil
+}
+
+// bindField is a whitespace separated word of the hostnames part
+type bindField struct {
+	text   string
+	offset int // Offset of the word in the segment
+}
+
+// fields splits a segment on whitespace, keeping the offset of each word
+func (s bindSegment) fields() []bindField {
+	var fields []bindField
+	begin := -1
+	for i := 0; i <= len(s.text); i++ {
+		if i < len(s.text) && !strings.ContainsRune(" \t\r\n", rune(s.text[i])) {
+			if begin < 0 {
+				begin = i
+			}
+			continue
+		}
+		if begin >= 0 {
+			fields = append(fields, bindField{text: s.text[begin:i], offset: begin})
+			begin = -1
+		}
+	}
+	return fields
+}
+
+// unsafeTokenChars would change the structure of the Caddyfile in a hostname or path
+const unsafeTokenChars = "{}\"`\\#"
+
+// parseBinding parses the hostnames, port, path and directives of a lexed binding
+func (g *Generator) parseBinding(binding bindBinding) (SiteConfig, error) {
+	fail := func(col int, format string, args ...interface{}) (SiteConfig, error) {
+		return SiteConfig{}, &bindError{binding: binding.index, column: col, msg: fmt.Sprintf(format, args...)}
+	}
+
+	head := binding.segments[0]
+	elements := head.fields()
+	var path string
+	if len(elements) > 0 && strings.HasPrefix(elements[0].text, "/") {
+		path = elements[0].text
+		if i := strings.IndexAny(path, unsafeTokenChars); i >= 0 {
+			return fail(head.col(elements[0].offset+i), "unexpected %c in path %s", path[i], path)
+		}
+		elements = elements[1:]
+	}
+
+	// The port is optional, hostnames never consist of digits only
+	var port int
+	if len(elements) > 0 && isNumeric(elements[0].text) {
+		var err error
+		port, err = strconv.Atoi(elements[0].text)
+		if err != nil || port <= 0 || port > 65535 {
+			return fail(head.col(elements[0].offset), "invalid port %s", elements[0].text)
+		}
+		elements = elements[1:]
+	}
+
+	if len(elements) == 0 {
+		return fail(head.start, "missing hostname")
+	}
+	var hostnames []string
+	for _, element := range elements {
+		if i := strings.IndexAny(element.text, unsafeTokenChars); i >= 0 {
+			return fail(head.col(element.offset+i), "unexpected %c in hostname %s", element.text[i], element.text)
+		}
+		hostnames = append(hostnames, element.text)
+	}
+
+	var directives []string
+	for _, segment := range binding.segments[1:] {
+		directive := strings.TrimSpace(segment.text)
+		if directive == "" {
+			return fail(segment.start, "empty directive")
+		}
+		// Directives must be valid Caddyfile on their own so they cannot break other sites
+		if _, err := caddyfile.Parse(directive); err != nil {
+			if syntaxErr, ok := err.(*caddyfile.Error); ok {
+				leading := len(segment.text) - len(strings.TrimLeft(segment.text, " \t\r\n"))
+				return fail(segment.col(leading+syntaxErr.Offset), "invalid directive: %s", syntaxErr.Msg)
+			}
+			return fail(segment.start, "invalid directive: %v", err)
+		}
+		directives = append(directives, directive)
+	}
+	hostDirectives, proxyDirectives := g.processDirectives(directives)
+
+	return SiteConfig{
+		Hostnames:       hostnames,
+		Port:            port,
+		PathMatcher:     path,
+		HostDirectives:  hostDirectives,
+		ProxyDirectives: proxyDirectives,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestBindConformance(t *testing.T) {
+	tests := []struct {
+		name  string
+		label string
+		want  []SiteConfig
+		err   string
+	}{
+		{
+			name:  "simple",
+			label: "80 example.com",
+			want:  []SiteConfig{{Hostnames: []string{"example.com"}, Port: 80}},
+		},
+		{
+			name:  "path and hostnames",
+			label: "/api/* 8080 a.example.com\tb.example.com",
+			want:  []SiteConfig{{Hostnames: []string{"a.example.com", "b.example.com"}, Port: 8080, PathMatcher: "/api/*"}},
+		},
+		{
+			name:  "several bindings",
+			label: " 80 a.example.com ;; 81 b.example.com; ",
+			want: []SiteConfig{
+				{Hostnames: []string{"a.example.com"}, Port: 80},
+				{Hostnames: []string{"b.example.com"}, Port: 81},
+			},
+		},
+		{
+			name:  "directives",
+			label: "80 example.com | host:tls internal | header_up Host {upstream_hostport}",
+			want: []SiteConfig{{
+				Hostnames:       []string{"example.com"},
+				Port:            80,
+				HostDirectives:  []string{"tls internal"},
+				ProxyDirectives: []string{"header_up Host {upstream_hostport}"},
+			}},
+		},
+		{
+			name:  "separators in quotes",
+			label: `80 example.com | header_down Strict-Transport-Security "max-age=31536000; includeSubDomains" | header_up X-Re ` + "`a|b`",
+			want: []SiteConfig{{
+				Hostnames: []string{"example.com"},
+				Port:      80,
+				ProxyDirectives: []string{
+					`header_down Strict-Transport-Security "max-age=31536000; includeSubDomains"`,
+					"header_up X-Re `a|b`",
+				},
+			}},
+		},
+		{
+			name:  "escaped quote in quotes",
+			label: `80 example.com | header_up X-A "say \"a;b\""; 81 b.example.com`,
+			want: []SiteConfig{
+				{Hostnames: []string{"example.com"}, Port: 80, ProxyDirectives: []string{`header_up X-A "say \"a;b\""`}},
+				{Hostnames: []string{"b.example.com"}, Port: 81},
+			},
+		},
+		{
+			name:  "escaped separators",
+			label: `80 example.com | header_up X-Re ^(a\|b)\;$ | header_up X-Path \d+`,
+			want: []SiteConfig{{
+				Hostnames:       []string{"example.com"},
+				Port:            80,
+				ProxyDirectives: []string{"header_up X-Re ^(a|b);$", `header_up X-Path \d+`},
+			}},
+		},
+		{
+			name: "blocks over several lines",
+			label: `80 example.com | host:tls {
+  dns cloudflare {env.CF_API_TOKEN}
+} | header {
+  Strict-Transport-Security max-age=31536000; includeSubDomains
+}`,
+			want: []SiteConfig{{
+				Hostnames:       []string{"example.com"},
+				Port:            80,
+				HostDirectives:  []string{"tls {\n  dns cloudflare {env.CF_API_TOKEN}\n}"},
+				ProxyDirectives: []string{"header {\n  Strict-Transport-Security max-age=31536000; includeSubDomains\n}"},
+			}},
+		},
+		{
+			name:  "unterminated quote",
+			label: `80 a.example.com; 80 b.example.com | header_up X-A "a`,
+			want:  []SiteConfig{{Hostnames: []string{"a.example.com"}, Port: 80}},
+			err:   "binding 2, column 52: unterminated quote \"",
+		},
+		{
+			name:  "unclosed brace",
+			label: "80 example.com | header {",
+			err:   "binding 1, column 25: unclosed {",
+		},
+		{
+			name:  "unexpected brace",
+			label: "80 example.com | header }",
+			err:   "binding 1, column 25: unexpected }",
+		},
+		{
+			name:  "invalid port",
+			label: "80 a.example.com; 70000 b.example.com",
+			want:  []SiteConfig{{Hostnames: []string{"a.example.com"}, Port: 80}},
+			err:   "binding 2, column 19: invalid port 70000",
+		},
+		{
+			name:  "missing hostname",
+			label: "80 | tls internal",
+			err:   "binding 1, column 1: missing hostname",
+		},
+		{
+			name:  "empty directive",
+			label: "80 example.com || flush -1",
+			err:   "binding 1, column 17: empty directive",
+		},
+		{
+			name:  "unbalanced directive",
+			label: "80 example.com | respond x{ }; 81 b.example.com",
+			want:  []SiteConfig{{Hostnames: []string{"b.example.com"}, Port: 81}},
+			err:   "binding 1, column 29: invalid directive: unexpected }",
+		},
+		{
+			name:  "brace in hostname",
+			label: "80 {env.HOST}",
+			err:   "binding 1, column 4: unexpected { in hostname {env.HOST}",
+		},
+		{
+			name:  "brace in path",
+			label: "/api{x} 80 example.com",
+			err:   "binding 1, column 5: unexpected { in path /api{x}",
+		},
+		{
+			name:  "comment in hostname",
+			label: "80 example.com #x",
+			err:   "binding 1, column 16: unexpected # in hostname #x",
+		},
+	}
+
+	generator := NewGenerator([]*docker.Client{{}}, &config.Config{Networks: []string{"gateway"}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []SiteConfig
+			var errText string
+			bindings, err := lexBind(tt.label)
+			if err != nil {
+				errText = err.Error()
+			}
+			for _, binding := range bindings {
+				site, err := generator.parseBinding(binding)
+				if err != nil {
+					errText = err.Error()
+					continue
+				}
+				got = append(got, site)
+			}
+			if errText != tt.err {
+				t.Errorf("error = %q; want %q", errText, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sites = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
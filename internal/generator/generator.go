@@ -3,10 +3,15 @@ package generator
 import (
 	"fmt"
 	"log"
+	"net"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gera2ld/caddy-gen/internal/caddyfile"
 	"github.com/gera2ld/caddy-gen/internal/config"
 	"github.com/gera2ld/caddy-gen/internal/docker"
 )
@@ -19,97 +24,384 @@ type SiteConfig struct {
 	Name            string
 	HostDirectives  []string
 	ProxyDirectives []string
-	ProxyIP         string
+	ProxyIP         string // Upstream address, an IP or a name resolved by Docker's embedded DNS
+	ProxyIPv6       string // Additional IPv6 upstream address in dual stack mode
+	Priority        int
+	LoadBalance     LoadBalance
+	Source          string // Name of the Docker host the site was discovered on
+	Origin          string // Labels the site is defined by, e.g. virtual.bind binding 2 or virtual.0.*
 }
 
+// matcherNameRe matches characters that are not allowed in generated matcher names
+var matcherNameRe = regexp.MustCompile(`[^a-z0-9-]+`)
+
 // Generator generates Caddy configuration
 type Generator struct {
-	docker *docker.Client
-	config *config.Config
+	clients []*docker.Client
+	config  *config.Config
+	// lastSites holds the last site configurations of each host, used when it is unreachable
+	lastSites map[*docker.Client][]SiteConfig
+	// pending counts the sites held back by readiness gating in the last generation
+	pending int
+	// sites holds the grouped sites of the last generation
+	sites []SiteConfig
+	// problems holds the invalid labels found in the last generation
+	problems []Problem
+	// labels holds the routing labels of each container or service of the last generation
+	labels map[string]map[string]string
 }
 
 // NewGenerator creates a new Generator
-func NewGenerator(dockerClient *docker.Client, cfg *config.Config) *Generator {
+func NewGenerator(clients []*docker.Client, cfg *config.Config) *Generator {
 	return &Generator{
-		docker: dockerClient,
-		config: cfg,
+		clients:   clients,
+		config:    cfg,
+		lastSites: make(map[*docker.Client][]SiteConfig),
 	}
 }
 
 // GenerateConfig generates Caddy configuration
 func (g *Generator) GenerateConfig() (string, error) {
-	// List containers
-	containers, err := g.docker.ListContainers()
+	// Collect site configurations from all hosts
+	g.pending = 0
+	g.problems = nil
+	g.labels = make(map[string]map[string]string)
+	siteConfigs, err := g.collectAllSiteConfigs()
 	if err != nil {
-		return "", fmt.Errorf("failed to list containers: %v", err)
+		return "", err
+	}
+	if g.config.Format == config.FormatJSON {
+		siteConfigs = g.checkJSONSites(siteConfigs)
 	}
 
-	// Process containers
-	siteConfigs := g.processSiteConfigs(containers)
-	
 	// Group by hostnames
 	groups := g.groupSiteConfigs(siteConfigs)
-	
+	g.sites = nil
+	for _, hostnames := range sortedGroupKeys(groups) {
+		g.sites = append(g.sites, groups[hostnames]...)
+	}
+
 	// Generate config
-	return g.generateCaddyConfig(groups), nil
+	if g.config.Format == config.FormatJSON {
+		return g.generateJSONConfig(groups)
+	}
+	return g.generateCaddyConfig(groups)
 }
 
-// processSiteConfigs processes containers and returns site configurations
-func (g *Generator) processSiteConfigs(containers []types.Container) []SiteConfig {
+// collectAllSiteConfigs collects site configurations from all hosts, keeping the last known
+// sites of a host that cannot be reached so its routes are not dropped
+func (g *Generator) collectAllSiteConfigs() ([]SiteConfig, error) {
 	var siteConfigs []SiteConfig
-	for _, container := range containers {
-		configs := g.processContainer(container)
+	failed := 0
+	for _, dockerClient := range g.clients {
+		configs, err := g.collectSiteConfigs(dockerClient)
+		if err != nil {
+			if len(g.clients) == 1 {
+				return nil, err
+			}
+			failed++
+			log.Printf("Failed to collect sites from host %s, keeping %d previous sites: %v",
+				dockerClient.Host().Name, len(g.lastSites[dockerClient]), err)
+			configs = g.lastSites[dockerClient]
+		} else {
+			g.lastSites[dockerClient] = configs
+		}
 		siteConfigs = append(siteConfigs, configs...)
 	}
+
+	if failed == len(g.clients) {
+		return nil, fmt.Errorf("failed to collect sites from all %d hosts", failed)
+	}
+	return siteConfigs, nil
+}
+
+// collectSiteConfigs lists containers, or services in swarm mode, and returns their site configurations
+func (g *Generator) collectSiteConfigs(dockerClient *docker.Client) ([]SiteConfig, error) {
+	host := dockerClient.Host()
+
+	if g.config.Mode == config.ModeSwarm {
+		services, err := dockerClient.ListServices()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list services: %v", err)
+		}
+
+		return g.processServices(host, services), nil
+	}
+
+	// List containers
+	containers, err := dockerClient.ListContainers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	// Process containers
+	return g.processSiteConfigs(host, containers), nil
+}
+
+// processServices processes swarm services of a host and returns site configurations
+func (g *Generator) processServices(host config.HostConfig, services []docker.ServiceInfo) []SiteConfig {
+	var siteConfigs []SiteConfig
+	for _, service := range services {
+		g.recordLabels(host.Name, service.Service.Spec.Name, service.Service.Spec.Labels)
+		start := len(g.problems)
+		if service.Err != nil {
+			g.labelError(service.Service.Spec.Name, "resolving addresses", service.Err)
+		} else {
+			for _, site := range g.processService(service) {
+				site.Source = host.Name
+				siteConfigs = append(siteConfigs, site)
+			}
+		}
+		g.setProblemSource(start, host.Name)
+	}
 	return siteConfigs
 }
 
-// groupSiteConfigs groups site configurations by hostnames
+// processSiteConfigs processes containers of a host and returns site configurations
+func (g *Generator) processSiteConfigs(host config.HostConfig, containers []types.Container) []SiteConfig {
+	var probes []siteProbe
+	for _, container := range containers {
+		g.recordLabels(host.Name, container.Names[0], container.Labels)
+		start := len(g.problems)
+		check, err := g.containerHealthCheck(container)
+		if err != nil {
+			g.labelError(container.Names[0], "parsing health check", err)
+			g.setProblemSource(start, host.Name)
+			continue
+		}
+
+		for _, site := range g.processContainer(container) {
+			site.Source = host.Name
+			if host.Upstream == config.HostUpstreamPublished {
+				if err := usePublishedPort(&site, container, host.Address); err != nil {
+					g.labelError(container.Names[0], "resolving published port for "+strings.Join(site.Hostnames, " "), err)
+					continue
+				}
+			}
+
+			if site.ProxyIP == "" && g.config.Published {
+				if err := g.useHostAddress(&site, container); err != nil {
+					g.labelError(container.Names[0], "resolving host address for "+strings.Join(site.Hostnames, " "), err)
+					continue
+				}
+			}
+
+			if site.ProxyIP == "" {
+				g.labelError(container.Names[0], "resolving address for "+strings.Join(site.Hostnames, " "),
+					fmt.Errorf("no reachable address on networks %v", g.config.Networks))
+				continue
+			}
+
+			probe := siteProbe{check: check, site: site, container: container.Names[0]}
+			probe.err = checkContainerReady(check, container)
+			probes = append(probes, probe)
+		}
+		g.setProblemSource(start, host.Name)
+	}
+
+	// Sites may only receive traffic once their containers are ready and their probes succeed
+	probeSites(probes)
+	var siteConfigs []SiteConfig
+	for _, probe := range probes {
+		if probe.err != nil {
+			log.Printf("Holding back %s for container %s: %v", probe.site.Upstream(), probe.container, probe.err)
+			g.pending++
+			continue
+		}
+		siteConfigs = append(siteConfigs, probe.site)
+	}
+	return siteConfigs
+}
+
+// Pending returns the number of sites held back by readiness gating in the last generation,
+// they are only picked up by another generation as no event signals a successful probe
+func (g *Generator) Pending() int {
+	return g.pending
+}
+
+// Sites returns the sites of the last generation, ordered like the output
+func (g *Generator) Sites() []SiteConfig {
+	return g.sites
+}
+
+// groupSiteConfigs groups site configurations by normalized hostnames
 func (g *Generator) groupSiteConfigs(siteConfigs []SiteConfig) map[string][]SiteConfig {
 	groups := make(map[string][]SiteConfig)
 	for _, item := range siteConfigs {
+		item.Hostnames = normalizeHostnames(item.Hostnames)
 		key := strings.Join(item.Hostnames, " ")
 		groups[key] = append(groups[key], item)
 	}
+	for _, group := range groups {
+		sortSiteConfigs(group)
+	}
 	return groups
 }
 
-// generateCaddyConfig generates Caddy configuration from grouped site configurations
-func (g *Generator) generateCaddyConfig(groups map[string][]SiteConfig) string {
+// normalizeHostnames lowercases, deduplicates and sorts hostnames
+func normalizeHostnames(hostnames []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, hostname := range hostnames {
+		hostname = strings.ToLower(strings.TrimSpace(hostname))
+		if hostname == "" || seen[hostname] {
+			continue
+		}
+		seen[hostname] = true
+		result = append(result, hostname)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// sortSiteConfigs orders sites by priority, then by path specificity, then by name
+func sortSiteConfigs(group []SiteConfig) {
+	sort.SliceStable(group, func(i, j int) bool {
+		a, b := group[i], group[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if pa, pb := pathSpecificity(a.PathMatcher), pathSpecificity(b.PathMatcher); pa != pb {
+			return pa > pb
+		}
+		if a.PathMatcher != b.PathMatcher {
+			return a.PathMatcher < b.PathMatcher
+		}
+		return a.Name < b.Name
+	})
+}
+
+// pathSpecificity returns a score where more specific paths rank higher
+func pathSpecificity(path string) int {
+	if path == "" {
+		return -1
+	}
+	// Wildcards match more requests, so they rank below exact paths of the same length
+	score := len(strings.TrimRight(path, "*")) * 2
+	if !strings.HasSuffix(path, "*") {
+		score++
+	}
+	return score
+}
+
+// sortedGroupKeys returns the keys of the groups in sorted order
+func sortedGroupKeys(groups map[string][]SiteConfig) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// matcherName derives a stable matcher name from hostnames
+func matcherName(hostnames string) string {
+	name := strings.ReplaceAll(hostnames, "*", "wildcard")
+	name = matcherNameRe.ReplaceAllString(strings.ToLower(name), "_")
+	return "@caddy-gen-" + strings.Trim(name, "_")
+}
+
+// generateCaddyConfig generates Caddy configuration from grouped site configurations,
+// formatted like caddy fmt
+func (g *Generator) generateCaddyConfig(groups map[string][]SiteConfig) (string, error) {
 	var configParts []string
-	i := 0
-	
-	for hostnames, group := range groups {
-		configParts = append(configParts, g.generateHostConfig(hostnames, group, i))
-		i++
+	used := make(map[string]bool)
+	groups = hostnameGroups(groups)
+
+	for _, hostnames := range sortedGroupKeys(groups) {
+		if g.config.Layout == config.LayoutSite {
+			configParts = append(configParts, g.generateSiteBlock(hostnames, groups[hostnames]))
+			continue
+		}
+
+		// Different hostnames may sanitize to the same name, keep them apart
+		name := matcherName(hostnames)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d", matcherName(hostnames), i)
+		}
+		used[name] = true
+		configParts = append(configParts, g.generateHostConfig(hostnames, groups[hostnames], name))
+	}
+
+	formatted, err := caddyfile.Format(strings.Join(configParts, "\n\n"))
+	if err != nil {
+		return "", fmt.Errorf("failed to format Caddyfile: %v", err)
+	}
+	return formatted, nil
+}
+
+// hostnameGroups regroups host groups by hostname, as Caddy rejects a hostname in several site
+// blocks and only runs the first handle block or route matching a host. Each hostname gets the
+// sites of all groups including it, and hostnames served by the same groups stay together.
+func hostnameGroups(groups map[string][]SiteConfig) map[string][]SiteConfig {
+	keysByHostname := make(map[string][]string)
+	for _, key := range sortedGroupKeys(groups) {
+		for _, hostname := range groups[key][0].Hostnames {
+			keysByHostname[hostname] = append(keysByHostname[hostname], key)
+		}
+	}
+
+	hostnamesByKeys := make(map[string][]string)
+	for hostname, keys := range keysByHostname {
+		joined := strings.Join(keys, "\n")
+		hostnamesByKeys[joined] = append(hostnamesByKeys[joined], hostname)
+	}
+
+	blocks := make(map[string][]SiteConfig)
+	for joined, hostnames := range hostnamesByKeys {
+		var group []SiteConfig
+		for _, key := range strings.Split(joined, "\n") {
+			group = append(group, groups[key]...)
+		}
+		sortSiteConfigs(group)
+		sort.Strings(hostnames)
+		blocks[strings.Join(hostnames, " ")] = group
 	}
-	
-	return strings.Join(configParts, "\n\n")
+	return blocks
 }
 
 // generateHostConfig generates configuration for a host group
-func (g *Generator) generateHostConfig(hostnames string, group []SiteConfig, index int) string {
-	hostMatcher := fmt.Sprintf("@caddy-gen-%d", index)
-	
+func (g *Generator) generateHostConfig(hostnames string, group []SiteConfig, hostMatcher string) string {
 	var sectionLines []string
 	sectionLines = append(sectionLines, fmt.Sprintf("%s host %s", hostMatcher, hostnames))
 	sectionLines = append(sectionLines, fmt.Sprintf("handle %s {", hostMatcher))
-	
+
 	// Add host directives
 	sectionLines = append(sectionLines, g.generateHostDirectives(group)...)
-	
+
 	// Add proxy directives
 	sectionLines = append(sectionLines, g.generateProxyDirectives(group)...)
-	
+
 	sectionLines = append(sectionLines, "}")
 	return strings.Join(sectionLines, "\n")
 }
 
-// generateHostDirectives generates host directives for a group
+// generateSiteBlock generates a site block for a host group
+func (g *Generator) generateSiteBlock(hostnames string, group []SiteConfig) string {
+	var sectionLines []string
+	sectionLines = append(sectionLines, fmt.Sprintf("%s {", hostnames))
+
+	// Add host directives
+	sectionLines = append(sectionLines, g.generateHostDirectives(group)...)
+
+	// Add proxy directives
+	sectionLines = append(sectionLines, g.generateProxyDirectives(group)...)
+
+	sectionLines = append(sectionLines, "}")
+	return strings.Join(sectionLines, "\n")
+}
+
+// generateHostDirectives generates host directives for a group, once each when several sites
+// of the group repeat them
 func (g *Generator) generateHostDirectives(group []SiteConfig) []string {
 	var lines []string
+	seen := make(map[string]bool)
 	for _, item := range group {
 		for _, directive := range item.HostDirectives {
+			if seen[directive] {
+				continue
+			}
+			seen[directive] = true
 			lines = append(lines, fmt.Sprintf("  %s", directive))
 		}
 	}
@@ -119,15 +411,19 @@ func (g *Generator) generateHostDirectives(group []SiteConfig) []string {
 // generateProxyDirectives generates proxy directives for a group
 func (g *Generator) generateProxyDirectives(group []SiteConfig) []string {
 	var lines []string
-	for _, item := range group {
-		lines = append(lines, fmt.Sprintf("  # %s", item.Name))
-		lines = append(lines, fmt.Sprintf("  reverse_proxy %s {", item.PathMatcher))
-		
-		for _, directive := range item.ProxyDirectives {
+	for _, route := range buildProxyRoutes(group) {
+		lines = append(lines, fmt.Sprintf("  # %s", strings.Join(route.Names, ", ")))
+		lines = append(lines, fmt.Sprintf("  reverse_proxy %s {", route.PathMatcher))
+
+		for _, directive := range route.LoadBalance.directives() {
 			lines = append(lines, fmt.Sprintf("    %s", directive))
 		}
-		
-		lines = append(lines, fmt.Sprintf("    to %s:%d", item.ProxyIP, item.Port))
+
+		for _, directive := range route.ProxyDirectives {
+			lines = append(lines, fmt.Sprintf("    %s", directive))
+		}
+
+		lines = append(lines, fmt.Sprintf("    to %s", strings.Join(route.Upstreams, " ")))
 		lines = append(lines, "  }")
 	}
 	return lines
@@ -135,74 +431,220 @@ func (g *Generator) generateProxyDirectives(group []SiteConfig) []string {
 
 // processContainer processes a container and returns site configurations
 func (g *Generator) processContainer(container types.Container) []SiteConfig {
-	var configs []SiteConfig
+	return g.processBindings(container.Names[0], container.Labels, func(config SiteConfig) ([]SiteConfig, error) {
+		config, err := g.resolveContainerSite(config, container)
+		if err != nil {
+			return nil, err
+		}
+		return []SiteConfig{config}, nil
+	})
+}
 
-	rawBind, exists := container.Labels["virtual.bind"]
-	if !exists || strings.TrimSpace(rawBind) == "" {
-		return configs
-	}
+// processService processes a swarm service and returns site configurations, one per address
+func (g *Generator) processService(service docker.ServiceInfo) []SiteConfig {
+	name := service.Service.Spec.Name
+	return g.processBindings(name, service.Service.Spec.Labels, func(config SiteConfig) ([]SiteConfig, error) {
+		if config.Port == 0 {
+			// Services have no exposed ports to infer from
+			rawPort, exists := service.Service.Spec.Labels["virtual.port"]
+			if !exists {
+				return nil, fmt.Errorf("port is required for services, set it in the binding or virtual.port")
+			}
+			var err error
+			if config.Port, err = parsePortLabel(rawPort); err != nil {
+				return nil, err
+			}
+		}
+		if len(service.Addresses) == 0 {
+			return nil, fmt.Errorf("no running tasks on networks %v", g.config.Networks)
+		}
+
+		var configs []SiteConfig
+		for _, address := range service.Addresses {
+			config.Name = name
+			config.ProxyIP = address
+			configs = append(configs, config)
+		}
+		return configs, nil
+	})
+}
 
-	// Process each binding
-	for _, bindInfo := range strings.Split(rawBind, ";") {
-		bindInfo = strings.TrimSpace(bindInfo)
-		if bindInfo == "" {
+// processBindings parses the routing labels of a container or service, both virtual.bind and the
+// indexed virtual.N.* labels, and resolves each binding to site configurations
+func (g *Generator) processBindings(name string, labels map[string]string, resolve func(SiteConfig) ([]SiteConfig, error)) []SiteConfig {
+	var bindings []SiteConfig
+
+	// Process each binding of virtual.bind, a syntax error drops the bindings after it
+	lexed, err := lexBind(labels["virtual.bind"])
+	if err != nil {
+		g.labelError(name, "parsing bind info", err)
+	}
+	for _, item := range lexed {
+		binding, err := g.parseBinding(item)
+		if err != nil {
+			g.labelError(name, "parsing bind info", err)
 			continue
 		}
+		binding.Origin = fmt.Sprintf("virtual.bind binding %d", item.index)
+		bindings = append(bindings, binding)
+	}
+
+	// Process the indexed labels
+	indexed, errs := parseIndexedLabels(labels)
+	for _, err := range errs {
+		g.labelError(name, "parsing labels", err)
+	}
+	bindings = append(bindings, indexed...)
+
+	var configs []SiteConfig
+	if len(bindings) == 0 {
+		return configs
+	}
 
-		config, err := g.parseBindInfo(bindInfo, container)
+	priority, err := parsePriority(labels["virtual.priority"])
+	if err != nil {
+		g.labelError(name, "parsing priority", err)
+	}
+
+	lb, err := parseLoadBalance(labels)
+	if err != nil {
+		g.labelError(name, "parsing load balancing", err)
+	}
+
+	for _, binding := range bindings {
+		resolved, err := resolve(binding)
 		if err != nil {
-			log.Printf("Error parsing bind info for container %s: %v", container.Names[0], err)
+			g.labelError(name, "resolving binding "+strings.Join(binding.Hostnames, " "), err)
 			continue
 		}
 
-		configs = append(configs, config)
+		for _, config := range resolved {
+			config.Priority = priority
+			config.LoadBalance = lb
+			configs = append(configs, config)
+		}
 	}
 
 	return configs
 }
 
-// parseBindInfo parses a bind info string and returns a site configuration
-func (g *Generator) parseBindInfo(bindInfo string, container types.Container) (SiteConfig, error) {
-	bindParts := strings.Split(bindInfo, "|")
-	bind := strings.TrimSpace(bindParts[0])
-	directives := bindParts[1:]
+// parsePriority parses the optional priority label
+func parsePriority(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	priority, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %s: %v", raw, err)
+	}
+	return priority, nil
+}
 
-	// Process bind part
-	bindElements := strings.Fields(bind)
-	var path string
-	if strings.HasPrefix(bind, "/") {
-		path = bindElements[0]
-		bindElements = bindElements[1:]
+// useHostAddress points a site of a container outside the networks at the Docker host, directly
+// for host networking or through the published port otherwise
+func (g *Generator) useHostAddress(site *SiteConfig, container types.Container) error {
+	if container.HostConfig.NetworkMode == "host" {
+		site.ProxyIP = g.config.HostGateway
+		return nil
 	}
+	return usePublishedPort(site, container, g.config.HostGateway)
+}
+
+// usePublishedPort points a site at the host port published for its container port, on the
+// address the port is bound to, or on the fallback address if it is bound to all addresses.
+// Ports bound to a loopback address cannot be reached from other containers or hosts.
+func usePublishedPort(site *SiteConfig, container types.Container, fallback string) error {
+	loopback := ""
+	for _, port := range container.Ports {
+		if int(port.PrivatePort) != site.Port || port.PublicPort == 0 || port.Type != "tcp" {
+			continue
+		}
+		ip := net.ParseIP(port.IP)
+		if ip != nil && ip.IsLoopback() {
+			loopback = port.IP
+			continue
+		}
+		site.ProxyIP = fallback
+		if ip != nil && !ip.IsUnspecified() {
+			site.ProxyIP = port.IP
+		}
+		site.Port = int(port.PublicPort)
+		return nil
+	}
+	if loopback != "" {
+		return fmt.Errorf("port %d is only published on loopback address %s", site.Port, loopback)
+	}
+	return fmt.Errorf("port %d is not published", site.Port)
+}
 
-	if len(bindElements) < 2 {
-		return SiteConfig{}, fmt.Errorf("invalid bind format: %s", bind)
+// parseBindInfo parses a bind info string and returns a site configuration for a container
+func (g *Generator) parseBindInfo(bindInfo string, container types.Container) (SiteConfig, error) {
+	config, err := g.parseBind(bindInfo)
+	if err != nil {
+		return SiteConfig{}, err
 	}
+	return g.resolveContainerSite(config, container)
+}
 
-	port, err := strconv.Atoi(bindElements[0])
+// resolveContainerSite fills in the upstream address, name and port of a binding for a container
+func (g *Generator) resolveContainerSite(config SiteConfig, container types.Container) (SiteConfig, error) {
+	// Get container address in the selected network
+	networkSettings, err := g.containerNetwork(container)
 	if err != nil {
-		return SiteConfig{}, fmt.Errorf("invalid port in binding %s: %v", bind, err)
+		return SiteConfig{}, err
+	}
+	if networkSettings != nil {
+		config.ProxyIP, config.ProxyIPv6, err = g.containerAddress(container, networkSettings)
+		if err != nil {
+			return SiteConfig{}, err
+		}
 	}
-	hostnames := bindElements[1:]
+	config.Name = strings.TrimPrefix(container.Names[0], "/")
+
+	// Infer the port if the binding omits it
+	if config.Port == 0 {
+		config.Port, err = inferPort(container)
+		if err != nil {
+			return SiteConfig{}, err
+		}
+	}
+
+	return config, nil
+}
 
-	// Process directives
-	hostDirectives, proxyDirectives := g.processDirectives(directives)
+// containerNetwork selects the network to proxy a container through, either from the
+// virtual.network label or the first monitored network the container is connected to
+func (g *Generator) containerNetwork(container types.Container) (*network.EndpointSettings, error) {
+	networks, err := g.config.SelectNetworks(container.Labels["virtual.network"])
+	if err != nil {
+		return nil, err
+	}
+	if container.NetworkSettings == nil {
+		return nil, nil
+	}
 
-	// Get container IP in the network
-	var proxyIP string
-	if networkSettings, exists := container.NetworkSettings.Networks[g.config.Network]; exists {
-		proxyIP = networkSettings.IPAddress
+	for _, name := range networks {
+		if networkSettings, exists := container.NetworkSettings.Networks[name]; exists {
+			return networkSettings, nil
+		}
+	}
+	if preferred := container.Labels["virtual.network"]; preferred != "" {
+		return nil, fmt.Errorf("container is not connected to network %s", preferred)
 	}
+	return nil, nil
+}
 
-	return SiteConfig{
-		Hostnames:       hostnames,
-		Port:            port,
-		PathMatcher:     path,
-		Name:            strings.TrimPrefix(container.Names[0], "/"),
-		HostDirectives:  hostDirectives,
-		ProxyDirectives: proxyDirectives,
-		ProxyIP:         proxyIP,
-	}, nil
+// parseBind parses the hostnames, port, path and directives of a single bind info string
+func (g *Generator) parseBind(bindInfo string) (SiteConfig, error) {
+	bindings, err := lexBind(bindInfo)
+	if err != nil {
+		return SiteConfig{}, err
+	}
+	if len(bindings) != 1 {
+		return SiteConfig{}, fmt.Errorf("expected one binding, found %d", len(bindings))
+	}
+	return g.parseBinding(bindings[0])
 }
 
 // processDirectives processes directives and separates them into host and proxy directives
@@ -217,4 +659,4 @@ func (g *Generator) processDirectives(directives []string) ([]string, []string)
 		}
 	}
 	return hostDirectives, proxyDirectives
-} 
\ No newline at end of file
+}
@@ -1,10 +1,13 @@
 package generator
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/gera2ld/caddy-gen/internal/config"
 	"github.com/gera2ld/caddy-gen/internal/docker"
 )
@@ -23,9 +26,9 @@ func TestParseBindInfo(t *testing.T) {
 	}
 
 	// Create generator
-	cfg := &config.Config{Network: "gateway"}
+	cfg := &config.Config{Networks: []string{"gateway"}}
 	dockerClient := &docker.Client{} // Mock client
-	generator := NewGenerator(dockerClient, cfg)
+	generator := NewGenerator([]*docker.Client{dockerClient}, cfg)
 
 	// Test simple bind
 	bindInfo := "80 example.com"
@@ -97,9 +100,9 @@ func TestProcessContainer(t *testing.T) {
 	}
 
 	// Create generator
-	cfg := &config.Config{Network: "gateway"}
+	cfg := &config.Config{Networks: []string{"gateway"}}
 	dockerClient := &docker.Client{} // Mock client
-	generator := NewGenerator(dockerClient, cfg)
+	generator := NewGenerator([]*docker.Client{dockerClient}, cfg)
 
 	// Test process container
 	configs := generator.processContainer(container)
@@ -116,4 +119,249 @@ func TestProcessContainer(t *testing.T) {
 	if configs[1].Port != 8080 || configs[1].Hostnames[0] != "api.example.com" || configs[1].PathMatcher != "/api" {
 		t.Errorf("configs[1] = %+v; want Port=8080, Hostnames=[api.example.com], PathMatcher=/api", configs[1])
 	}
-} 
\ No newline at end of file
+}
+
+func TestGenerateCaddyConfigDeterministic(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{Hostnames: []string{"www.example.com", "Example.com"}, Port: 80, Name: "web", ProxyIP: "172.17.0.2"},
+		{Hostnames: []string{"api.example.com"}, Port: 8080, Name: "api", ProxyIP: "172.17.0.3"},
+		{Hostnames: []string{"example.com", "www.example.com"}, Port: 3000, PathMatcher: "/api/*", Name: "backend", ProxyIP: "172.17.0.4"},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	expected, err := generator.generateCaddyConfig(generator.groupSiteConfigs(siteConfigs))
+	if err != nil {
+		t.Fatalf("generateCaddyConfig() error = %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		// Reverse input order to make sure output does not depend on it
+		reversed := make([]SiteConfig, len(siteConfigs))
+		for j, item := range siteConfigs {
+			reversed[len(siteConfigs)-1-j] = item
+		}
+		siteConfigs = reversed
+		if result, _ := generator.generateCaddyConfig(generator.groupSiteConfigs(siteConfigs)); result != expected {
+			t.Fatalf("generateCaddyConfig() is not deterministic:\n%s\n---\n%s", result, expected)
+		}
+	}
+
+	groups := generator.groupSiteConfigs(siteConfigs)
+	if len(groups) != 2 {
+		t.Fatalf("groupSiteConfigs() returned %d groups; want 2", len(groups))
+	}
+	group := groups["example.com www.example.com"]
+	if len(group) != 2 || group[0].Name != "backend" || group[1].Name != "web" {
+		t.Errorf("group = %+v; want backend before web", group)
+	}
+	if !strings.Contains(expected, "@caddy-gen-example_com_www_example_com host example.com www.example.com") {
+		t.Errorf("generateCaddyConfig() = %s; want matcher derived from hostnames", expected)
+	}
+}
+
+func TestSortSiteConfigs(t *testing.T) {
+	group := []SiteConfig{
+		{Name: "root"},
+		{Name: "wildcard", PathMatcher: "/api/*"},
+		{Name: "exact", PathMatcher: "/api/v1"},
+		{Name: "priority", PathMatcher: "/", Priority: 10},
+	}
+	sortSiteConfigs(group)
+
+	var names []string
+	for _, item := range group {
+		names = append(names, item.Name)
+	}
+	if strings.Join(names, ",") != "priority,exact,wildcard,root" {
+		t.Errorf("sortSiteConfigs() order = %v; want [priority exact wildcard root]", names)
+	}
+}
+
+func TestGenerateSiteBlocks(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{
+			Hostnames:      []string{"www.example.com", "example.com"},
+			Port:           80,
+			Name:           "web",
+			ProxyIP:        "172.17.0.2",
+			HostDirectives: []string{"tls internal"},
+		},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Layout: config.LayoutSite}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	result, err := generator.generateCaddyConfig(generator.groupSiteConfigs(siteConfigs))
+	expected := "example.com www.example.com {\n\ttls internal\n\t# web\n\treverse_proxy {\n\t\tto 172.17.0.2:80\n\t}\n}\n"
+	if err != nil || result != expected {
+		t.Errorf("generateCaddyConfig() = %q, %v; want %q", result, err, expected)
+	}
+}
+
+func TestGenerateSiteBlocksOverlapping(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{Hostnames: []string{"example.com", "www.example.com"}, Port: 80, Name: "web", ProxyIP: "172.17.0.2",
+			HostDirectives: []string{"tls internal"}},
+		{Hostnames: []string{"www.example.com"}, Port: 8080, Name: "api", ProxyIP: "172.17.0.3",
+			PathMatcher: "/api/*", HostDirectives: []string{"tls internal"}},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Layout: config.LayoutSite}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	// www.example.com gets one site block with the routes of both groups
+	result, err := generator.generateCaddyConfig(generator.groupSiteConfigs(siteConfigs))
+	expected := "example.com {\n\ttls internal\n\t# web\n\treverse_proxy {\n\t\tto 172.17.0.2:80\n\t}\n}\n\n" +
+		"www.example.com {\n\ttls internal\n" +
+		"\t# api\n\treverse_proxy /api/* {\n\t\tto 172.17.0.3:8080\n\t}\n" +
+		"\t# web\n\treverse_proxy {\n\t\tto 172.17.0.2:80\n\t}\n}\n"
+	if err != nil || result != expected {
+		t.Errorf("generateCaddyConfig() = %q, %v; want %q", result, err, expected)
+	}
+}
+
+func TestGenerateHandleBlocksOverlapping(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{Hostnames: []string{"example.com", "www.example.com"}, Port: 80, Name: "web", ProxyIP: "172.17.0.2"},
+		{Hostnames: []string{"www.example.com"}, Port: 8080, Name: "api", ProxyIP: "172.17.0.3", PathMatcher: "/api/*"},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	// Only the first matching handle block runs, so www.example.com gets a single one
+	result, err := generator.generateCaddyConfig(generator.groupSiteConfigs(siteConfigs))
+	if err != nil || strings.Count(result, "www.example.com") != 1 || !strings.Contains(result, "@caddy-gen-www_example_com host www.example.com\n") {
+		t.Errorf("generateCaddyConfig() = %q, %v; want one handle block for www.example.com", result, err)
+	}
+}
+
+func TestGenerateFormatsDirectives(t *testing.T) {
+	// Blocks folded onto one line by YAML are split again
+	container := types.Container{
+		Names: []string{"/web"},
+		Labels: map[string]string{
+			"virtual.bind": "80 example.com | host:tls { dns cloudflare {env.CF_API_TOKEN} } | header_up X-A \"a;b\"",
+		},
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"gateway": {IPAddress: "172.17.0.2"}},
+		},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	result, err := generator.generateCaddyConfig(generator.groupSiteConfigs(generator.processContainer(container)))
+	expected := "@caddy-gen-example_com host example.com\n" +
+		"handle @caddy-gen-example_com {\n" +
+		"\ttls {\n\t\tdns cloudflare {env.CF_API_TOKEN}\n\t}\n" +
+		"\t# web\n\treverse_proxy {\n\t\theader_up X-A \"a;b\"\n\t\tto 172.17.0.2:80\n\t}\n}\n"
+	if err != nil || result != expected {
+		t.Errorf("generateCaddyConfig() = %q, %v; want %q", result, err, expected)
+	}
+}
+
+func TestProcessService(t *testing.T) {
+	service := docker.ServiceInfo{
+		Service: swarm.Service{
+			Spec: swarm.ServiceSpec{
+				Annotations: swarm.Annotations{
+					Name:   "web",
+					Labels: map[string]string{"virtual.bind": "80 example.com"},
+				},
+			},
+		},
+		Addresses: []string{"10.0.1.5", "10.0.1.6"},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Mode: config.ModeSwarm}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	configs := generator.processService(service)
+	if len(configs) != 2 {
+		t.Fatalf("processService() returned %d configs; want 2", len(configs))
+	}
+	if configs[0].Name != "web" || configs[0].ProxyIP != "10.0.1.5" || configs[1].ProxyIP != "10.0.1.6" {
+		t.Errorf("configs = %+v; want web on 10.0.1.5 and 10.0.1.6", configs)
+	}
+
+	service.Addresses = nil
+	if configs := generator.processService(service); len(configs) != 0 {
+		t.Errorf("processService() returned %d configs; want 0 without addresses", len(configs))
+	}
+
+	// Services whose addresses cannot be resolved are reported
+	service.Err = errors.New(`network "other" is not monitored`)
+	configs = generator.processServices(config.HostConfig{Name: "vm2"}, []docker.ServiceInfo{service})
+	problems := generator.Problems()
+	if len(configs) != 0 || len(problems) != 2 || problems[1].String() != `web (vm2): resolving addresses: network "other" is not monitored` {
+		t.Errorf("processServices() = %+v, problems %v; want the address error of web on vm2", configs, problems)
+	}
+}
+
+func TestContainerNetwork(t *testing.T) {
+	container := types.Container{
+		Names:  []string{"/test-container"},
+		Labels: map[string]string{},
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"public":   {IPAddress: "172.18.0.2"},
+				"internal": {IPAddress: "172.19.0.2"},
+			},
+		},
+	}
+
+	cfg := &config.Config{Networks: []string{"internal", "public"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	// Falls back to the first monitored network in configured order
+	siteConfig, err := generator.parseBindInfo("80 example.com", container)
+	if err != nil || siteConfig.ProxyIP != "172.19.0.2" {
+		t.Errorf("parseBindInfo() = %s, %v; want 172.19.0.2", siteConfig.ProxyIP, err)
+	}
+
+	// Label selects the network
+	container.Labels["virtual.network"] = "public"
+	siteConfig, err = generator.parseBindInfo("80 example.com", container)
+	if err != nil || siteConfig.ProxyIP != "172.18.0.2" {
+		t.Errorf("parseBindInfo() = %s, %v; want 172.18.0.2", siteConfig.ProxyIP, err)
+	}
+
+	// Label must name a monitored network
+	container.Labels["virtual.network"] = "other"
+	if _, err := generator.parseBindInfo("80 example.com", container); err == nil {
+		t.Error("parseBindInfo() error = nil; want error for unmonitored network")
+	}
+}
+
+func TestProcessSiteConfigsPublished(t *testing.T) {
+	containers := []types.Container{
+		{
+			Names:  []string{"/web"},
+			State:  "running",
+			Labels: map[string]string{"virtual.bind": "80 example.com; 8080 admin.example.com"},
+			Ports: []types.Port{
+				{PrivatePort: 80, PublicPort: 8000, Type: "tcp"},
+			},
+		},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	host := config.HostConfig{Name: "vm2", Upstream: config.HostUpstreamPublished, Address: "10.0.0.2"}
+	configs := generator.processSiteConfigs(host, containers)
+	if len(configs) != 1 {
+		t.Fatalf("processSiteConfigs() returned %d configs; want 1 with the unpublished port skipped", len(configs))
+	}
+	if configs[0].Upstream() != "10.0.0.2:8000" || configs[0].Source != "vm2" {
+		t.Errorf("configs[0] = %+v; want 10.0.0.2:8000 from vm2", configs[0])
+	}
+	if configs[0].displayName() != "web (vm2)" {
+		t.Errorf("displayName() = %s; want web (vm2)", configs[0].displayName())
+	}
+	if problems := generator.Problems(); len(problems) != 1 || !strings.Contains(problems[0].String(), "web (vm2): resolving published port for admin.example.com") {
+		t.Errorf("Problems() = %v; want the unpublished port of web", problems)
+	}
+}
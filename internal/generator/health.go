@@ -0,0 +1,151 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+// Readiness probes run concurrently, each within probeTimeout and all within probeDeadline
+const (
+	probeTimeout        = 2 * time.Second
+	probeDeadline       = 10 * time.Second
+	maxConcurrentProbes = 16
+)
+
+// Docker health states as shown in the container status
+const (
+	healthNone      = ""
+	healthStarting  = "starting"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+// healthCheck is the readiness gating of a container
+type healthCheck struct {
+	Mode string // One of the config.Health* modes
+	Path string // Request path of HTTP probes
+}
+
+// parseHealthCheck parses a gating mode like "tcp" or "http:/healthz"
+func parseHealthCheck(raw string) (healthCheck, error) {
+	mode, path, err := config.ParseHealth(raw)
+	if err != nil {
+		return healthCheck{}, err
+	}
+	return healthCheck{Mode: mode, Path: path}, nil
+}
+
+// dockerHealth extracts the Docker health state from a container status like "Up 5 minutes (healthy)"
+func dockerHealth(status string) string {
+	switch {
+	case strings.Contains(status, "(health: starting)"):
+		return healthStarting
+	case strings.Contains(status, "(unhealthy)"):
+		return healthUnhealthy
+	case strings.Contains(status, "(healthy)"):
+		return healthHealthy
+	}
+	return healthNone
+}
+
+// containerHealthCheck returns the gating of a container, from its virtual.health label or the default
+func (g *Generator) containerHealthCheck(container types.Container) (healthCheck, error) {
+	raw, exists := container.Labels["virtual.health"]
+	if !exists {
+		raw = g.config.Health
+	}
+	return parseHealthCheck(raw)
+}
+
+// checkContainerReady checks the Docker state and health of a container before probing its sites
+func checkContainerReady(check healthCheck, container types.Container) error {
+	if check.Mode == config.HealthNone {
+		return nil
+	}
+	if container.State != "running" {
+		return fmt.Errorf("container is %s", container.State)
+	}
+
+	// A failing healthcheck always withdraws the routes, a starting one holds them back
+	switch dockerHealth(container.Status) {
+	case healthUnhealthy:
+		return fmt.Errorf("container is unhealthy")
+	case healthStarting:
+		return fmt.Errorf("container health is starting")
+	}
+	return nil
+}
+
+// siteProbe is the readiness probe of a site, with its outcome
+type siteProbe struct {
+	check     healthCheck
+	site      SiteConfig
+	container string
+	err       error
+}
+
+// probeSites runs the readiness probes of sites concurrently and records their outcome. Probes
+// not done by probeDeadline fail, so one generation is not held up by many unreachable upstreams
+func probeSites(probes []siteProbe) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeDeadline)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxConcurrentProbes)
+	for i := range probes {
+		// Sites of containers that are not ready are not probed
+		mode := probes[i].check.Mode
+		if probes[i].err != nil || (mode != config.HealthTCP && mode != config.HealthHTTP) {
+			continue
+		}
+		wg.Add(1)
+		go func(probe *siteProbe) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				probe.err = probeSite(ctx, probe.check, probe.site)
+			case <-ctx.Done():
+				probe.err = fmt.Errorf("probe not run: %v", ctx.Err())
+			}
+		}(&probes[i])
+	}
+	wg.Wait()
+}
+
+// probeSite runs the readiness probe of a site against its upstream
+func probeSite(ctx context.Context, check healthCheck, site SiteConfig) error {
+	switch check.Mode {
+	case config.HealthTCP:
+		dialer := &net.Dialer{Timeout: probeTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", site.Upstream())
+		if err != nil {
+			return fmt.Errorf("TCP probe failed: %v", err)
+		}
+		return conn.Close()
+
+	case config.HealthHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", site.Upstream(), check.Path), nil)
+		if err != nil {
+			return fmt.Errorf("HTTP probe failed: %v", err)
+		}
+		client := &http.Client{Timeout: probeTimeout}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("HTTP probe failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("HTTP probe failed with status %d", resp.StatusCode)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	tests := map[string]healthCheck{
+		"":             {Mode: config.HealthAuto},
+		"docker":       {Mode: config.HealthDocker},
+		"TCP":          {Mode: config.HealthTCP},
+		"http":         {Mode: config.HealthHTTP, Path: "/"},
+		"http:/health": {Mode: config.HealthHTTP, Path: "/health"},
+		"none":         {Mode: config.HealthNone},
+	}
+	for raw, want := range tests {
+		if got, err := parseHealthCheck(raw); err != nil || got != want {
+			t.Errorf("parseHealthCheck(%q) = %+v, %v; want %+v", raw, got, err, want)
+		}
+	}
+
+	for _, raw := range []string{"ping", "tcp:/x", "http:health"} {
+		if _, err := parseHealthCheck(raw); err == nil {
+			t.Errorf("parseHealthCheck(%q) error = nil; want error", raw)
+		}
+	}
+}
+
+func TestHealthGating(t *testing.T) {
+	newContainer := func(state, status string, labels map[string]string) types.Container {
+		labels["virtual.bind"] = "80 example.com"
+		return types.Container{
+			Names:  []string{"/web"},
+			State:  state,
+			Status: status,
+			Labels: labels,
+			NetworkSettings: &types.SummaryNetworkSettings{
+				Networks: map[string]*network.EndpointSettings{"gateway": {IPAddress: "172.17.0.2"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		container types.Container
+		routed    bool
+	}{
+		{newContainer("running", "Up 5 minutes", map[string]string{}), true},
+		{newContainer("running", "Up 5 minutes (healthy)", map[string]string{}), true},
+		{newContainer("running", "Up 5 seconds (health: starting)", map[string]string{}), false},
+		{newContainer("running", "Up 5 minutes (unhealthy)", map[string]string{}), false},
+		{newContainer("restarting", "Restarting (1) 2 seconds ago", map[string]string{}), false},
+		{newContainer("created", "Created", map[string]string{}), false},
+		{newContainer("created", "Created", map[string]string{"virtual.health": "none"}), true},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Health: config.HealthAuto}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	for _, test := range tests {
+		generator.pending = 0
+		configs := generator.processSiteConfigs(config.HostConfig{}, []types.Container{test.container})
+		if routed := len(configs) == 1; routed != test.routed {
+			t.Errorf("container %s %q routed = %v; want %v", test.container.State, test.container.Status, routed, test.routed)
+		}
+		if pending := generator.Pending() == 1; pending == test.routed {
+			t.Errorf("container %s %q pending = %v; want %v", test.container.State, test.container.Status, pending, !test.routed)
+		}
+	}
+}
+
+func TestProbeSite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	host, rawPort, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(rawPort)
+	site := SiteConfig{ProxyIP: host, Port: port}
+
+	if err := probeSite(context.Background(), healthCheck{Mode: config.HealthTCP}, site); err != nil {
+		t.Errorf("probeSite(tcp) error = %v", err)
+	}
+	if err := probeSite(context.Background(), healthCheck{Mode: config.HealthHTTP, Path: "/healthz"}, site); err != nil {
+		t.Errorf("probeSite(http:/healthz) error = %v", err)
+	}
+	if err := probeSite(context.Background(), healthCheck{Mode: config.HealthHTTP, Path: "/"}, site); err == nil {
+		t.Error("probeSite(http:/) error = nil; want error for status 503")
+	}
+
+	server.Close()
+	if err := probeSite(context.Background(), healthCheck{Mode: config.HealthTCP}, site); err == nil {
+		t.Error("probeSite(tcp) error = nil; want error for closed port")
+	}
+}
+
+func TestProbeSites(t *testing.T) {
+	// Each request waits for the other two, so sequential probes would time out
+	var arrived sync.WaitGroup
+	arrived.Add(3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		arrived.Wait()
+	}))
+	defer server.Close()
+
+	host, rawPort, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(rawPort)
+	site := SiteConfig{ProxyIP: host, Port: port}
+	check := healthCheck{Mode: config.HealthHTTP, Path: "/"}
+	notReady := errors.New("container is exited")
+	probes := []siteProbe{
+		{check: check, site: site}, {check: check, site: site}, {check: check, site: site},
+		{check: check, site: site, err: notReady},
+	}
+
+	probeSites(probes)
+	for i, probe := range probes[:3] {
+		if probe.err != nil {
+			t.Errorf("probes[%d] error = %v; want concurrent probes to succeed", i, probe.err)
+		}
+	}
+	if probes[3].err != notReady {
+		t.Errorf("probes[3] error = %v; want the container error kept without probing", probes[3].err)
+	}
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Problem is an invalid routing label of a container or service, which drops some of its sites
+type Problem struct {
+	Name   string // Container or service name
+	Source string // Name of the Docker host the container or service was discovered on
+	Err    error
+}
+
+func (p Problem) String() string {
+	if p.Source == "" {
+		return fmt.Sprintf("%s: %v", p.Name, p.Err)
+	}
+	return fmt.Sprintf("%s (%s): %v", p.Name, p.Source, p.Err)
+}
+
+// Problems returns the invalid labels found in the last generation
+func (g *Generator) Problems() []Problem {
+	return g.problems
+}
+
+// labelError logs and records an invalid label of a container or service
+func (g *Generator) labelError(name, action string, err error) {
+	log.Printf("Error %s for %s: %v", action, name, err)
+	g.problems = append(g.problems, Problem{Name: strings.TrimPrefix(name, "/"), Err: fmt.Errorf("%s: %v", action, err)})
+}
+
+// setProblemSource sets the Docker host of the problems recorded since start
+func (g *Generator) setProblemSource(start int, source string) {
+	for i := start; i < len(g.problems); i++ {
+		g.problems[i].Source = source
+	}
+}
+
+// recordLabels keeps the routing labels of a container or service to explain its sites
+func (g *Generator) recordLabels(source, name string, labels map[string]string) {
+	routing := make(map[string]string)
+	for key, value := range labels {
+		if strings.HasPrefix(key, "virtual.") {
+			routing[key] = value
+		}
+	}
+	if len(routing) == 0 {
+		return
+	}
+	if g.labels == nil {
+		g.labels = make(map[string]map[string]string)
+	}
+	g.labels[source+"\x00"+strings.TrimPrefix(name, "/")] = routing
+}
+
+// Labels returns the routing labels of the container or service a site of the last generation
+// belongs to, or nil for sites kept from an unreachable host
+func (g *Generator) Labels(site SiteConfig) map[string]string {
+	return g.labels[site.Source+"\x00"+site.Name]
+}
+
+// SitesFor returns the sites of the last generation serving a hostname, ordered like the output.
+// Schemes and ports are ignored, and a wildcard hostname matches one label, like in Caddy.
+func (g *Generator) SitesFor(hostname string) []SiteConfig {
+	hostname = bareHostname(hostname)
+	var sites []SiteConfig
+	for _, site := range g.sites {
+		for _, pattern := range site.Hostnames {
+			if matchHostname(bareHostname(pattern), hostname) {
+				sites = append(sites, site)
+				break
+			}
+		}
+	}
+	return sites
+}
+
+// bareHostname lowercases a site address and strips its scheme and port
+func bareHostname(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if _, rest, found := strings.Cut(address, "://"); found {
+		address = rest
+	}
+	if i := strings.LastIndex(address, ":"); i >= 0 && !strings.HasSuffix(address, "]") {
+		address = address[:i]
+	}
+	return address
+}
+
+// matchHostname reports whether a hostname matches a site hostname, which may start with *.
+func matchHostname(pattern, hostname string) bool {
+	if pattern == hostname {
+		return true
+	}
+	if suffix, found := strings.CutPrefix(pattern, "*."); found {
+		label, rest, ok := strings.Cut(hostname, ".")
+		return ok && label != "" && rest == suffix
+	}
+	return false
+}
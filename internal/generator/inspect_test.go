@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestProcessSiteConfigsProblems(t *testing.T) {
+	networks := &types.SummaryNetworkSettings{
+		Networks: map[string]*network.EndpointSettings{"gateway": {IPAddress: "172.17.0.2"}},
+	}
+	containers := []types.Container{
+		{
+			Names:           []string{"/web"},
+			State:           "running",
+			Labels:          map[string]string{"virtual.bind": "80 example.com; 80 {bad", "virtual.priority": "high", "other": "x"},
+			NetworkSettings: networks,
+		},
+		{
+			Names:           []string{"/api"},
+			State:           "running",
+			Labels:          map[string]string{"virtual.0.host": "*.example.com", "virtual.0.port": "8080"},
+			NetworkSettings: networks,
+		},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Health: config.HealthNone}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+	sites := generator.processSiteConfigs(config.HostConfig{Name: "vm2"}, containers)
+	generator.sites = sites
+
+	problems := generator.Problems()
+	if len(problems) != 2 || problems[0].Name != "web" || problems[0].Source != "vm2" ||
+		!strings.Contains(problems[0].String(), "web (vm2): parsing bind info: binding 2") {
+		t.Errorf("Problems() = %v; want the bind and priority errors of web on vm2", problems)
+	}
+
+	if sites[0].Origin != "virtual.bind binding 1" || sites[1].Origin != "virtual.0.*" {
+		t.Errorf("origins = %s, %s; want virtual.bind binding 1 and virtual.0.*", sites[0].Origin, sites[1].Origin)
+	}
+	labels := generator.Labels(sites[0])
+	if len(labels) != 2 || labels["virtual.priority"] != "high" {
+		t.Errorf("Labels() = %v; want the routing labels of web", labels)
+	}
+
+	tests := map[string][]string{
+		"example.com":             {"web"},
+		"https://API.example.com": {"api"},
+		"a.b.example.com":         nil,
+		"other.com":               nil,
+	}
+	for hostname, want := range tests {
+		var names []string
+		for _, site := range generator.SitesFor(hostname) {
+			names = append(names, site.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(want, ",") {
+			t.Errorf("SitesFor(%s) = %v; want %v", hostname, names, want)
+		}
+	}
+}
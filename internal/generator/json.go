@@ -0,0 +1,276 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// JSONServerName is the name of the HTTP server generated in JSON mode
+const JSONServerName = "caddy-gen"
+
+// CaddyJSONConfig is the root of a native Caddy JSON configuration
+type CaddyJSONConfig struct {
+	Apps CaddyJSONApps `json:"apps"`
+}
+
+// CaddyJSONApps holds the Caddy apps generated by caddy-gen
+type CaddyJSONApps struct {
+	HTTP CaddyHTTPApp `json:"http"`
+}
+
+// CaddyHTTPApp is the configuration of Caddy's http app
+type CaddyHTTPApp struct {
+	Servers map[string]*CaddyHTTPServer `json:"servers"`
+}
+
+// CaddyHTTPServer is an HTTP server in Caddy's http app
+type CaddyHTTPServer struct {
+	Listen []string     `json:"listen"`
+	Routes []CaddyRoute `json:"routes"`
+}
+
+// CaddyRoute is a route with matchers and handlers
+type CaddyRoute struct {
+	Match    []CaddyMatcher `json:"match,omitempty"`
+	Handle   []CaddyHandler `json:"handle"`
+	Terminal bool           `json:"terminal,omitempty"`
+}
+
+// CaddyMatcher is a request matcher set
+type CaddyMatcher struct {
+	Host []string `json:"host,omitempty"`
+	Path []string `json:"path,omitempty"`
+}
+
+// CaddyHandler is an HTTP handler, only the fields used by caddy-gen are modeled
+type CaddyHandler struct {
+	Handler       string              `json:"handler"`
+	Routes        []CaddyRoute        `json:"routes,omitempty"`
+	Upstreams     []CaddyUpstream     `json:"upstreams,omitempty"`
+	Headers       *CaddyHeaderOps     `json:"headers,omitempty"`
+	LoadBalancing *CaddyLoadBalancing `json:"load_balancing,omitempty"`
+}
+
+// CaddyLoadBalancing is the load balancing configuration of a reverse proxy
+type CaddyLoadBalancing struct {
+	SelectionPolicy map[string]string `json:"selection_policy,omitempty"`
+	Retries         int               `json:"retries,omitempty"`
+	TryDuration     string            `json:"try_duration,omitempty"`
+}
+
+// CaddyUpstream is a reverse proxy upstream
+type CaddyUpstream struct {
+	Dial string `json:"dial"`
+}
+
+// CaddyHeaderOps holds request and response header manipulations of a reverse proxy
+type CaddyHeaderOps struct {
+	Request  *CaddyHeaderOp `json:"request,omitempty"`
+	Response *CaddyHeaderOp `json:"response,omitempty"`
+}
+
+// CaddyHeaderOp sets or deletes header fields
+type CaddyHeaderOp struct {
+	Set    map[string][]string `json:"set,omitempty"`
+	Delete []string            `json:"delete,omitempty"`
+}
+
+// generateJSONConfig generates native Caddy JSON configuration from grouped site configurations
+func (g *Generator) generateJSONConfig(groups map[string][]SiteConfig) (string, error) {
+	data, err := json.MarshalIndent(g.buildJSONConfig(groups), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON config: %v", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// buildJSONConfig builds the typed Caddy JSON structure from grouped site configurations
+func (g *Generator) buildJSONConfig(groups map[string][]SiteConfig) *CaddyJSONConfig {
+	server := &CaddyHTTPServer{
+		Listen: []string{":443"},
+		Routes: []CaddyRoute{},
+	}
+
+	groups = hostnameGroups(groups)
+	for _, hostnames := range sortedGroupKeys(groups) {
+		server.Routes = append(server.Routes, g.buildHostRoute(strings.Fields(hostnames), groups[hostnames]))
+	}
+
+	return &CaddyJSONConfig{
+		Apps: CaddyJSONApps{
+			HTTP: CaddyHTTPApp{
+				Servers: map[string]*CaddyHTTPServer{JSONServerName: server},
+			},
+		},
+	}
+}
+
+// checkJSONSites drops the sites with directives that cannot be translated to JSON and records
+// them as problems, so no site is served without directives it relies on
+func (g *Generator) checkJSONSites(siteConfigs []SiteConfig) []SiteConfig {
+	var supported []SiteConfig
+	for _, site := range siteConfigs {
+		if err := checkJSONDirectives(site); err != nil {
+			start := len(g.problems)
+			g.labelError(site.Name, "generating JSON for "+strings.Join(site.Hostnames, " "), err)
+			g.setProblemSource(start, site.Source)
+			continue
+		}
+		supported = append(supported, site)
+	}
+	return supported
+}
+
+// checkJSONDirectives checks that all directives of a site are supported in JSON mode
+func checkJSONDirectives(site SiteConfig) error {
+	if len(site.HostDirectives) > 0 {
+		return fmt.Errorf("host directives are not supported: %s", strings.Join(site.HostDirectives, "; "))
+	}
+	for _, directive := range site.ProxyDirectives {
+		if !applyJSONProxyDirective(&CaddyHandler{}, directive) {
+			return fmt.Errorf("proxy directive is not supported: %s", directive)
+		}
+	}
+	return nil
+}
+
+// buildHostRoute builds a route matching the hostnames of a group
+func (g *Generator) buildHostRoute(hostnames []string, group []SiteConfig) CaddyRoute {
+	var routes []CaddyRoute
+	for _, route := range buildProxyRoutes(group) {
+		routes = append(routes, g.buildProxyRoute(route))
+	}
+
+	return CaddyRoute{
+		Match: []CaddyMatcher{{Host: hostnames}},
+		Handle: []CaddyHandler{{
+			Handler: "subroute",
+			Routes:  routes,
+		}},
+		Terminal: true,
+	}
+}
+
+// buildProxyRoute builds a reverse proxy route for a merged proxy route
+func (g *Generator) buildProxyRoute(route *proxyRoute) CaddyRoute {
+	handler := CaddyHandler{
+		Handler:       "reverse_proxy",
+		LoadBalancing: buildJSONLoadBalancing(route.LoadBalance),
+	}
+	for _, upstream := range route.Upstreams {
+		handler.Upstreams = append(handler.Upstreams, CaddyUpstream{Dial: upstream})
+	}
+
+	names := strings.Join(route.Names, ", ")
+	for _, directive := range route.ProxyDirectives {
+		if !applyJSONProxyDirective(&handler, directive) {
+			log.Printf("Skipping proxy directive for %s, not supported in JSON mode: %s", names, directive)
+		}
+	}
+
+	result := CaddyRoute{Handle: []CaddyHandler{handler}}
+	if route.PathMatcher != "" {
+		result.Match = []CaddyMatcher{{Path: []string{route.PathMatcher}}}
+	}
+	return result
+}
+
+// buildJSONLoadBalancing converts load balancing settings to the reverse_proxy JSON structure
+func buildJSONLoadBalancing(lb LoadBalance) *CaddyLoadBalancing {
+	if lb == (LoadBalance{}) {
+		return nil
+	}
+
+	result := &CaddyLoadBalancing{
+		Retries:     lb.Retries,
+		TryDuration: lb.TryDuration,
+	}
+	if args := strings.Fields(lb.Policy); len(args) > 0 {
+		policy := map[string]string{"policy": args[0]}
+		// Policies keyed by a request field take it as their only argument
+		if len(args) > 1 {
+			switch args[0] {
+			case "header":
+				policy["field"] = args[1]
+			case "query":
+				policy["key"] = args[1]
+			case "cookie":
+				policy["name"] = args[1]
+			}
+		}
+		result.SelectionPolicy = policy
+	}
+	return result
+}
+
+// applyJSONProxyDirective maps a supported reverse_proxy subdirective onto the handler
+func applyJSONProxyDirective(handler *CaddyHandler, directive string) bool {
+	args := splitArgs(directive)
+	if len(args) < 2 || len(args) > 3 {
+		return false
+	}
+
+	if args[0] != "header_up" && args[0] != "header_down" {
+		return false
+	}
+	field := args[1]
+	deleteField := strings.HasPrefix(field, "-")
+	if (deleteField && len(args) != 2) || (!deleteField && len(args) != 3) {
+		return false
+	}
+
+	if handler.Headers == nil {
+		handler.Headers = &CaddyHeaderOps{}
+	}
+	op := &handler.Headers.Request
+	if args[0] == "header_down" {
+		op = &handler.Headers.Response
+	}
+	if *op == nil {
+		*op = &CaddyHeaderOp{}
+	}
+
+	if deleteField {
+		(*op).Delete = append((*op).Delete, strings.TrimPrefix(field, "-"))
+		return true
+	}
+	if (*op).Set == nil {
+		(*op).Set = make(map[string][]string)
+	}
+	(*op).Set[field] = append((*op).Set[field], args[2])
+	return true
+}
+
+// splitArgs splits a directive into arguments, honoring double quotes
+func splitArgs(directive string) []string {
+	var args []string
+	var current strings.Builder
+	inQuotes, hasArg := false, false
+
+	for i := 0; i < len(directive); i++ {
+		ch := directive[i]
+		switch {
+		case ch == '\\' && inQuotes && i+1 < len(directive) && directive[i+1] == '"':
+			current.WriteByte('"')
+			i++
+		case ch == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case !inQuotes && (ch == ' ' || ch == '\t' || ch == '\n'):
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		default:
+			current.WriteByte(ch)
+			hasArg = true
+		}
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return args
+}
@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestGenerateJSONConfig(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{
+			Hostnames:       []string{"example.com"},
+			Port:            80,
+			Name:            "web",
+			ProxyIP:         "172.17.0.2",
+			ProxyDirectives: []string{`header_up X-Test "a b"`, "header_down -Server", "unsupported"},
+		},
+		{Hostnames: []string{"example.com"}, Port: 8080, PathMatcher: "/api", Name: "api", ProxyIP: "172.17.0.3"},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Format: config.FormatJSON}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	output, err := generator.generateJSONConfig(generator.groupSiteConfigs(siteConfigs))
+	if err != nil {
+		t.Fatalf("generateJSONConfig() error = %v", err)
+	}
+
+	var parsed CaddyJSONConfig
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		t.Fatalf("generateJSONConfig() returned invalid JSON: %v", err)
+	}
+
+	server := parsed.Apps.HTTP.Servers[JSONServerName]
+	if server == nil || len(server.Routes) != 1 {
+		t.Fatalf("servers = %+v; want one route in %s", parsed.Apps.HTTP.Servers, JSONServerName)
+	}
+	route := server.Routes[0]
+	if len(route.Match) != 1 || route.Match[0].Host[0] != "example.com" {
+		t.Errorf("route.Match = %+v; want host example.com", route.Match)
+	}
+
+	subroutes := route.Handle[0].Routes
+	if len(subroutes) != 2 {
+		t.Fatalf("subroutes = %+v; want 2", subroutes)
+	}
+	if subroutes[0].Match[0].Path[0] != "/api" || subroutes[0].Handle[0].Upstreams[0].Dial != "172.17.0.3:8080" {
+		t.Errorf("subroutes[0] = %+v; want /api to 172.17.0.3:8080", subroutes[0])
+	}
+	headers := subroutes[1].Handle[0].Headers
+	if headers == nil || headers.Request.Set["X-Test"][0] != "a b" || headers.Response.Delete[0] != "Server" {
+		t.Errorf("subroutes[1] headers = %+v; want X-Test set and Server deleted", headers)
+	}
+}
+
+func TestGenerateJSONConfigOverlapping(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{Hostnames: []string{"example.com", "www.example.com"}, Port: 80, Name: "web", ProxyIP: "172.17.0.2"},
+		{Hostnames: []string{"www.example.com"}, Port: 8080, PathMatcher: "/api/*", Name: "api", ProxyIP: "172.17.0.3"},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Format: config.FormatJSON}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	// www.example.com gets one route with the subroutes of both groups, so /api/* is reachable
+	routes := generator.buildJSONConfig(generator.groupSiteConfigs(siteConfigs)).Apps.HTTP.Servers[JSONServerName].Routes
+	if len(routes) != 2 {
+		t.Fatalf("routes = %+v; want one per hostname", routes)
+	}
+	if hosts := routes[0].Match[0].Host; len(hosts) != 1 || hosts[0] != "example.com" || len(routes[0].Handle[0].Routes) != 1 {
+		t.Errorf("routes[0] = %+v; want example.com with web only", routes[0])
+	}
+	subroutes := routes[1].Handle[0].Routes
+	if hosts := routes[1].Match[0].Host; len(hosts) != 1 || hosts[0] != "www.example.com" || len(subroutes) != 2 ||
+		subroutes[0].Match[0].Path[0] != "/api/*" {
+		t.Errorf("routes[1] = %+v; want www.example.com with api before web", routes[1])
+	}
+}
+
+func TestCheckJSONSites(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{Hostnames: []string{"example.com"}, Name: "web", ProxyDirectives: []string{"header_up X-Test a"}},
+		{Hostnames: []string{"example.com"}, Name: "api", Source: "vm2", ProxyDirectives: []string{"transport http"}},
+		{Hostnames: []string{"admin.example.com"}, Name: "admin", HostDirectives: []string{"tls internal"}},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Format: config.FormatJSON}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	// Sites with unsupported directives are dropped instead of served without them
+	sites := generator.checkJSONSites(siteConfigs)
+	if len(sites) != 1 || sites[0].Name != "web" {
+		t.Errorf("checkJSONSites() = %+v; want only web", sites)
+	}
+	problems := generator.Problems()
+	if len(problems) != 2 || problems[0].Name != "api" || problems[0].Source != "vm2" || problems[1].Name != "admin" {
+		t.Errorf("Problems() = %v; want api and admin", problems)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args := splitArgs(`header_up X-Test "a \"b\" c"`)
+	if len(args) != 3 || args[2] != `a "b" c` {
+		t.Errorf("splitArgs() = %q; want 3 args with quoted value", args)
+	}
+}
@@ -0,0 +1,202 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gera2ld/caddy-gen/internal/caddyfile"
+)
+
+// indexedLabelPrefix prefixes the structured labels, e.g. virtual.0.host
+const indexedLabelPrefix = "virtual."
+
+// indexedDirective is a directive label of a binding, e.g. virtual.0.proxy.header_up.1
+type indexedDirective struct {
+	name  string
+	order int
+	value string
+}
+
+// indexedBinding collects the labels of one index
+type indexedBinding struct {
+	host, port, path string
+	site, proxy      []indexedDirective
+	err              error // First invalid directive, which drops the binding
+}
+
+// parseIndexedLabels parses the virtual.N.* labels into bindings ordered by index, skipping
+// indexes with errors
+func parseIndexedLabels(labels map[string]string) ([]SiteConfig, []error) {
+	bindings := make(map[int]*indexedBinding)
+	var errs []error
+
+	for key, value := range labels {
+		index, field, ok := splitIndexedLabel(key)
+		if !ok {
+			continue
+		}
+		binding := bindings[index]
+		if binding == nil {
+			binding = &indexedBinding{}
+			bindings[index] = binding
+		}
+
+		switch {
+		case field == "host":
+			binding.host = value
+		case field == "port":
+			binding.port = value
+		case field == "path":
+			binding.path = value
+		case strings.HasPrefix(field, "site."):
+			directive, err := parseIndexedDirective(strings.TrimPrefix(field, "site."), value)
+			if err != nil {
+				binding.fail(fmt.Errorf("label %s: %v", key, err))
+				continue
+			}
+			binding.site = append(binding.site, directive)
+		case strings.HasPrefix(field, "proxy."):
+			directive, err := parseIndexedDirective(strings.TrimPrefix(field, "proxy."), value)
+			if err != nil {
+				binding.fail(fmt.Errorf("label %s: %v", key, err))
+				continue
+			}
+			binding.proxy = append(binding.proxy, directive)
+		default:
+			errs = append(errs, fmt.Errorf("unknown label %s", key))
+		}
+	}
+
+	indexes := make([]int, 0, len(bindings))
+	for index := range bindings {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var configs []SiteConfig
+	for _, index := range indexes {
+		config, err := bindings[index].siteConfig()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("binding %d: %v", index, err))
+			continue
+		}
+		config.Origin = fmt.Sprintf("%s%d.*", indexedLabelPrefix, index)
+		configs = append(configs, config)
+	}
+	return configs, errs
+}
+
+// splitIndexedLabel splits a label like virtual.0.proxy.header_up into its index and field
+func splitIndexedLabel(key string) (int, string, bool) {
+	if !strings.HasPrefix(key, indexedLabelPrefix) {
+		return 0, "", false
+	}
+	rawIndex, field, found := strings.Cut(strings.TrimPrefix(key, indexedLabelPrefix), ".")
+	if !found || !isNumeric(rawIndex) {
+		return 0, "", false
+	}
+	index, err := strconv.Atoi(rawIndex)
+	if err != nil {
+		return 0, "", false
+	}
+	return index, field, true
+}
+
+// parseIndexedDirective parses a directive label, where an optional numeric suffix orders
+// repeated directives, e.g. header_up.0 and header_up.1
+func parseIndexedDirective(field, value string) (indexedDirective, error) {
+	name, rawOrder, found := strings.Cut(field, ".")
+	directive := indexedDirective{name: name, value: strings.TrimSpace(value)}
+	if name == "" {
+		return directive, fmt.Errorf("missing directive name")
+	}
+	if found {
+		order, err := strconv.Atoi(rawOrder)
+		if err != nil || !isNumeric(rawOrder) {
+			return directive, fmt.Errorf("invalid directive order %s", rawOrder)
+		}
+		directive.order = order
+	}
+	// Directives must be valid Caddyfile on their own so they cannot break other sites
+	if _, err := caddyfile.Parse(directive.line()); err != nil {
+		return directive, fmt.Errorf("invalid directive: %v", err)
+	}
+	return directive, nil
+}
+
+// line renders a directive as a "name value" line
+func (d indexedDirective) line() string {
+	if d.value == "" {
+		return d.name
+	}
+	return d.name + " " + d.value
+}
+
+// fail records the first invalid directive of a binding
+func (b *indexedBinding) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// siteConfig converts the labels of one index to a site configuration
+func (b *indexedBinding) siteConfig() (SiteConfig, error) {
+	if b.err != nil {
+		return SiteConfig{}, b.err
+	}
+
+	hostnames := strings.FieldsFunc(b.host, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	if len(hostnames) == 0 {
+		return SiteConfig{}, fmt.Errorf("missing host")
+	}
+	for _, hostname := range hostnames {
+		if i := strings.IndexAny(hostname, unsafeTokenChars); i >= 0 {
+			return SiteConfig{}, fmt.Errorf("unexpected %c in hostname %s", hostname[i], hostname)
+		}
+	}
+
+	var port int
+	if rawPort := strings.TrimSpace(b.port); rawPort != "" {
+		var err error
+		port, err = strconv.Atoi(rawPort)
+		if err != nil || port <= 0 || port > 65535 {
+			return SiteConfig{}, fmt.Errorf("invalid port %s", rawPort)
+		}
+	}
+
+	path := strings.TrimSpace(b.path)
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return SiteConfig{}, fmt.Errorf("path %s must start with /", path)
+	}
+	if i := strings.IndexAny(path, unsafeTokenChars+" \t\r\n"); i >= 0 {
+		return SiteConfig{}, fmt.Errorf("unexpected %q in path %s", path[i], path)
+	}
+
+	return SiteConfig{
+		Hostnames:       hostnames,
+		Port:            port,
+		PathMatcher:     path,
+		HostDirectives:  indexedDirectiveLines(b.site),
+		ProxyDirectives: indexedDirectiveLines(b.proxy),
+	}, nil
+}
+
+// indexedDirectiveLines renders directives sorted by name and order, as "name value" lines
+func indexedDirectiveLines(directives []indexedDirective) []string {
+	sort.Slice(directives, func(i, j int) bool {
+		if directives[i].name != directives[j].name {
+			return directives[i].name < directives[j].name
+		}
+		return directives[i].order < directives[j].order
+	})
+
+	var lines []string
+	for _, directive := range directives {
+		lines = append(lines, directive.line())
+	}
+	return lines
+}
@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestParseIndexedLabels(t *testing.T) {
+	labels := map[string]string{
+		"virtual.bind":                "ignored.example.com",
+		"virtual.port":                "8080",
+		"virtual.10.host":             "b.example.com",
+		"virtual.2.host":              "a.example.com, www.a.example.com",
+		"virtual.2.port":              "3000",
+		"virtual.2.path":              "/api/*",
+		"virtual.2.proxy.header_up.1": "X-Second b",
+		"virtual.2.proxy.header_up":   "X-First a",
+		"virtual.2.proxy.header_down": "-Server",
+		"virtual.2.site.tls":          "internal",
+		"virtual.2.site.header":       `X-Regex "^(a|b);c$"`,
+		"virtual.3.port":              "80",
+		"virtual.4.host":              "c.example.com",
+		"virtual.4.port":              "http",
+		"virtual.5.host":              "d.example.com",
+		"virtual.5.unknown":           "x",
+		"virtual.6.host":              "bad.example.com {",
+		"virtual.7.host":              "e.example.com",
+		"virtual.7.path":              `/a" b`,
+	}
+
+	configs, errs := parseIndexedLabels(labels)
+	want := []SiteConfig{
+		{
+			Hostnames:       []string{"a.example.com", "www.a.example.com"},
+			Port:            3000,
+			PathMatcher:     "/api/*",
+			HostDirectives:  []string{`header X-Regex "^(a|b);c$"`, "tls internal"},
+			ProxyDirectives: []string{"header_down -Server", "header_up X-First a", "header_up X-Second b"},
+			Origin:          "virtual.2.*",
+		},
+		{Hostnames: []string{"d.example.com"}, Origin: "virtual.5.*"},
+		{Hostnames: []string{"b.example.com"}, Origin: "virtual.10.*"},
+	}
+	if !reflect.DeepEqual(configs, want) {
+		t.Errorf("parseIndexedLabels() = %+v; want %+v", configs, want)
+	}
+	// Missing host, invalid port, unknown field, brace in hostname and quote in path
+	if len(errs) != 5 {
+		t.Errorf("parseIndexedLabels() errors = %v; want 5 errors", errs)
+	}
+}
+
+func TestProcessContainerIndexedLabels(t *testing.T) {
+	container := types.Container{
+		Names: []string{"/web"},
+		Labels: map[string]string{
+			"virtual.bind":          "80 legacy.example.com",
+			"virtual.0.host":        "example.com",
+			"virtual.0.proxy.flush": "-1",
+			"virtual.priority":      "5",
+		},
+		Ports: []types.Port{{PrivatePort: 8080, Type: "tcp"}},
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"gateway": {IPAddress: "172.17.0.2"}},
+		},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	configs := generator.processContainer(container)
+	if len(configs) != 2 {
+		t.Fatalf("processContainer() returned %d configs; want 2", len(configs))
+	}
+	if configs[0].Hostnames[0] != "legacy.example.com" || configs[0].Port != 80 {
+		t.Errorf("configs[0] = %+v; want legacy.example.com on port 80", configs[0])
+	}
+	// The port is inferred from the single exposed port
+	site := configs[1]
+	if site.Hostnames[0] != "example.com" || site.Port != 8080 || site.ProxyIP != "172.17.0.2" ||
+		site.Name != "web" || site.Priority != 5 || !reflect.DeepEqual(site.ProxyDirectives, []string{"flush -1"}) {
+		t.Errorf("configs[1] = %+v; want example.com proxied to 172.17.0.2:8080 with flush -1", site)
+	}
+}
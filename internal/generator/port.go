@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// inferPort picks the upstream port of a container from its virtual.port label, or its only exposed port
+func inferPort(container types.Container) (int, error) {
+	if rawPort, exists := container.Labels["virtual.port"]; exists {
+		return parsePortLabel(rawPort)
+	}
+
+	ports := exposedPorts(container)
+	switch len(ports) {
+	case 0:
+		return 0, fmt.Errorf("no port in binding and container exposes none, set virtual.port")
+	case 1:
+		return ports[0], nil
+	}
+
+	var candidates []string
+	for _, port := range ports {
+		candidates = append(candidates, strconv.Itoa(port))
+	}
+	return 0, fmt.Errorf("no port in binding and container exposes %s, set virtual.port to pick one",
+		strings.Join(candidates, ", "))
+}
+
+// exposedPorts returns the distinct private TCP ports of a container in ascending order
+func exposedPorts(container types.Container) []int {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, port := range container.Ports {
+		// Ports published on several host addresses are listed once for each
+		if port.Type != "tcp" || seen[int(port.PrivatePort)] {
+			continue
+		}
+		seen[int(port.PrivatePort)] = true
+		ports = append(ports, int(port.PrivatePort))
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// parsePortLabel parses a port given by number like 8080 or 8080/tcp, or by service name like http
+func parsePortLabel(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	name := strings.TrimSuffix(raw, "/tcp")
+	if name == "" {
+		return 0, fmt.Errorf("empty virtual.port")
+	}
+
+	if isNumeric(name) {
+		port, err := strconv.Atoi(name)
+		if err != nil || port <= 0 || port > 65535 {
+			return 0, fmt.Errorf("invalid virtual.port %s", raw)
+		}
+		return port, nil
+	}
+
+	port, err := net.LookupPort("tcp", name)
+	if err != nil {
+		return 0, fmt.Errorf("invalid virtual.port %s: %v", raw, err)
+	}
+	return port, nil
+}
+
+// isNumeric checks whether a string consists of digits only
+func isNumeric(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, ch := range value {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestInferPort(t *testing.T) {
+	container := types.Container{
+		Names:  []string{"/web"},
+		Labels: map[string]string{},
+		Ports: []types.Port{
+			{IP: "0.0.0.0", PrivatePort: 3000, PublicPort: 3000, Type: "tcp"},
+			{IP: "::", PrivatePort: 3000, PublicPort: 3000, Type: "tcp"},
+			{PrivatePort: 53, Type: "udp"},
+		},
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"gateway": {IPAddress: "172.17.0.2"}},
+		},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	// Single exposed port
+	siteConfig, err := generator.parseBindInfo("app.example.com", container)
+	if err != nil || siteConfig.Port != 3000 || siteConfig.Hostnames[0] != "app.example.com" {
+		t.Errorf("parseBindInfo() = %+v, %v; want port 3000 for app.example.com", siteConfig, err)
+	}
+
+	// Path without port
+	siteConfig, err = generator.parseBindInfo("/api app.example.com", container)
+	if err != nil || siteConfig.Port != 3000 || siteConfig.PathMatcher != "/api" {
+		t.Errorf("parseBindInfo() = %+v, %v; want /api on port 3000", siteConfig, err)
+	}
+
+	// Ambiguous ports
+	container.Ports = append(container.Ports, types.Port{PrivatePort: 9090, Type: "tcp"})
+	if _, err := generator.parseBindInfo("app.example.com", container); err == nil {
+		t.Error("parseBindInfo() error = nil; want error for ambiguous ports")
+	}
+
+	// Label picks the port
+	container.Labels["virtual.port"] = "9090/tcp"
+	siteConfig, err = generator.parseBindInfo("app.example.com", container)
+	if err != nil || siteConfig.Port != 9090 {
+		t.Errorf("parseBindInfo() = %+v, %v; want port 9090", siteConfig, err)
+	}
+
+	// Port in binding wins over the label
+	siteConfig, err = generator.parseBindInfo("8080 app.example.com", container)
+	if err != nil || siteConfig.Port != 8080 {
+		t.Errorf("parseBindInfo() = %+v, %v; want port 8080", siteConfig, err)
+	}
+}
+
+func TestParsePortLabel(t *testing.T) {
+	tests := map[string]int{
+		"8080":     8080,
+		"8080/tcp": 8080,
+		"http":     80,
+		"https":    443,
+	}
+	for raw, want := range tests {
+		if got, err := parsePortLabel(raw); err != nil || got != want {
+			t.Errorf("parsePortLabel(%q) = %d, %v; want %d", raw, got, err, want)
+		}
+	}
+
+	for _, raw := range []string{"", "0", "70000", "no-such-service"} {
+		if _, err := parsePortLabel(raw); err == nil {
+			t.Errorf("parsePortLabel(%q) error = nil; want error", raw)
+		}
+	}
+}
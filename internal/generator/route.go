@@ -0,0 +1,149 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadBalance holds the load balancing settings of a reverse proxy
+type LoadBalance struct {
+	Policy      string // lb_policy, e.g. round_robin or "header X-User"
+	Retries     int    // lb_retries
+	TryDuration string // lb_try_duration, e.g. 5s
+}
+
+// proxyRoute is a reverse proxy for one path in a host group, merged from all sites sharing it
+type proxyRoute struct {
+	PathMatcher     string
+	Names           []string
+	Upstreams       []string
+	ProxyDirectives []string
+	LoadBalance     LoadBalance
+}
+
+// Upstream returns the dial address of the site, with IPv6 literals in brackets
+func (s SiteConfig) Upstream() string {
+	return net.JoinHostPort(s.ProxyIP, strconv.Itoa(s.Port))
+}
+
+// Upstreams returns the dial addresses of the site, including the IPv6 address in dual stack mode
+func (s SiteConfig) Upstreams() []string {
+	upstreams := []string{s.Upstream()}
+	if s.ProxyIPv6 != "" {
+		upstreams = append(upstreams, net.JoinHostPort(s.ProxyIPv6, strconv.Itoa(s.Port)))
+	}
+	return upstreams
+}
+
+// displayName returns the name of the site, with the Docker host it was discovered on
+func (s SiteConfig) displayName() string {
+	if s.Source == "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%s (%s)", s.Name, s.Source)
+}
+
+// buildProxyRoutes merges sites with the same path in a sorted group into proxy routes
+func buildProxyRoutes(group []SiteConfig) []*proxyRoute {
+	var routes []*proxyRoute
+	byPath := make(map[string]*proxyRoute)
+
+	for _, item := range group {
+		route, exists := byPath[item.PathMatcher]
+		if !exists {
+			route = &proxyRoute{PathMatcher: item.PathMatcher}
+			byPath[item.PathMatcher] = route
+			routes = append(routes, route)
+		}
+
+		route.Names = appendUnique(route.Names, item.displayName())
+		for _, upstream := range item.Upstreams() {
+			route.Upstreams = appendUnique(route.Upstreams, upstream)
+		}
+		for _, directive := range item.ProxyDirectives {
+			route.ProxyDirectives = appendUnique(route.ProxyDirectives, directive)
+		}
+		route.LoadBalance = mergeLoadBalance(route.LoadBalance, item.LoadBalance, item.Name)
+	}
+
+	return routes
+}
+
+// mergeLoadBalance fills unset load balancing settings, the first site that sets a value wins
+func mergeLoadBalance(current, next LoadBalance, name string) LoadBalance {
+	if next.Policy != "" {
+		if current.Policy == "" {
+			current.Policy = next.Policy
+		} else if current.Policy != next.Policy {
+			log.Printf("Ignoring lb_policy %q of %s, conflicts with %q", next.Policy, name, current.Policy)
+		}
+	}
+	if next.Retries != 0 {
+		if current.Retries == 0 {
+			current.Retries = next.Retries
+		} else if current.Retries != next.Retries {
+			log.Printf("Ignoring lb_retries %d of %s, conflicts with %d", next.Retries, name, current.Retries)
+		}
+	}
+	if next.TryDuration != "" {
+		if current.TryDuration == "" {
+			current.TryDuration = next.TryDuration
+		} else if current.TryDuration != next.TryDuration {
+			log.Printf("Ignoring lb_try_duration %q of %s, conflicts with %q", next.TryDuration, name, current.TryDuration)
+		}
+	}
+	return current
+}
+
+// directives returns the load balancing subdirectives for a Caddyfile reverse_proxy block
+func (lb LoadBalance) directives() []string {
+	var directives []string
+	if lb.Policy != "" {
+		directives = append(directives, "lb_policy "+lb.Policy)
+	}
+	if lb.Retries != 0 {
+		directives = append(directives, fmt.Sprintf("lb_retries %d", lb.Retries))
+	}
+	if lb.TryDuration != "" {
+		directives = append(directives, "lb_try_duration "+lb.TryDuration)
+	}
+	return directives
+}
+
+// parseLoadBalance parses the load balancing labels of a container
+func parseLoadBalance(labels map[string]string) (LoadBalance, error) {
+	lb := LoadBalance{
+		Policy:      strings.Join(strings.Fields(labels["virtual.lb_policy"]), " "),
+		TryDuration: strings.TrimSpace(labels["virtual.lb_try_duration"]),
+	}
+
+	if raw := strings.TrimSpace(labels["virtual.lb_retries"]); raw != "" {
+		retries, err := strconv.Atoi(raw)
+		if err != nil || retries < 0 {
+			return LoadBalance{}, fmt.Errorf("invalid lb_retries %s", raw)
+		}
+		lb.Retries = retries
+	}
+
+	if lb.TryDuration != "" {
+		if _, err := time.ParseDuration(lb.TryDuration); err != nil {
+			return LoadBalance{}, fmt.Errorf("invalid lb_try_duration %s: %v", lb.TryDuration, err)
+		}
+	}
+
+	return lb, nil
+}
+
+// appendUnique appends a value to a slice unless it is already present
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
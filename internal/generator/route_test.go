@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestBuildProxyRoutes(t *testing.T) {
+	group := []SiteConfig{
+		{Name: "web-1", Port: 80, ProxyIP: "172.17.0.2", ProxyDirectives: []string{"header_up X-A 1"}, LoadBalance: LoadBalance{Policy: "round_robin"}},
+		{Name: "web-2", Port: 80, ProxyIP: "172.17.0.3", ProxyDirectives: []string{"header_up X-A 1"}, LoadBalance: LoadBalance{Policy: "first", Retries: 2}},
+		{Name: "api", Port: 8080, PathMatcher: "/api", ProxyIP: "172.17.0.4"},
+	}
+	sortSiteConfigs(group)
+
+	routes := buildProxyRoutes(group)
+	if len(routes) != 2 {
+		t.Fatalf("buildProxyRoutes() returned %d routes; want 2", len(routes))
+	}
+	if routes[0].PathMatcher != "/api" || len(routes[0].Upstreams) != 1 {
+		t.Errorf("routes[0] = %+v; want /api with one upstream", routes[0])
+	}
+
+	route := routes[1]
+	if strings.Join(route.Upstreams, " ") != "172.17.0.2:80 172.17.0.3:80" {
+		t.Errorf("route.Upstreams = %v; want both replicas", route.Upstreams)
+	}
+	if strings.Join(route.Names, ",") != "web-1,web-2" || len(route.ProxyDirectives) != 1 {
+		t.Errorf("route = %+v; want merged names and deduplicated directives", route)
+	}
+	if route.LoadBalance.Policy != "round_robin" || route.LoadBalance.Retries != 2 {
+		t.Errorf("route.LoadBalance = %+v; want round_robin with 2 retries", route.LoadBalance)
+	}
+}
+
+func TestGenerateLoadBalancedProxy(t *testing.T) {
+	siteConfigs := []SiteConfig{
+		{Hostnames: []string{"example.com"}, Port: 80, Name: "web-2", ProxyIP: "172.17.0.3"},
+		{Hostnames: []string{"example.com"}, Port: 80, Name: "web-1", ProxyIP: "172.17.0.2", LoadBalance: LoadBalance{Policy: "least_conn", TryDuration: "5s"}},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Layout: config.LayoutSite}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	result, err := generator.generateCaddyConfig(generator.groupSiteConfigs(siteConfigs))
+	expected := "example.com {\n\t# web-1, web-2\n\treverse_proxy {\n\t\tlb_policy least_conn\n\t\tlb_try_duration 5s\n\t\tto 172.17.0.2:80 172.17.0.3:80\n\t}\n}\n"
+	if err != nil || result != expected {
+		t.Errorf("generateCaddyConfig() = %q, %v; want %q", result, err, expected)
+	}
+}
+
+func TestParseLoadBalance(t *testing.T) {
+	lb, err := parseLoadBalance(map[string]string{
+		"virtual.lb_policy":       "header  X-User",
+		"virtual.lb_retries":      "3",
+		"virtual.lb_try_duration": "10s",
+	})
+	if err != nil {
+		t.Fatalf("parseLoadBalance() error = %v", err)
+	}
+	if lb.Policy != "header X-User" || lb.Retries != 3 || lb.TryDuration != "10s" {
+		t.Errorf("parseLoadBalance() = %+v; want header X-User, 3, 10s", lb)
+	}
+
+	if _, err := parseLoadBalance(map[string]string{"virtual.lb_retries": "many"}); err == nil {
+		t.Error("parseLoadBalance() error = nil; want error for invalid retries")
+	}
+	if _, err := parseLoadBalance(map[string]string{"virtual.lb_try_duration": "soon"}); err == nil {
+		t.Error("parseLoadBalance() error = nil; want error for invalid try duration")
+	}
+}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+// composeServiceLabel is the label Docker Compose sets to the service name
+const composeServiceLabel = "com.docker.compose.service"
+
+// containerAddress returns the upstream address of a container on a network, by the
+// virtual.upstream label or the default addressing mode, and an additional IPv6 address in dual stack mode
+func (g *Generator) containerAddress(container types.Container, networkSettings *network.EndpointSettings) (string, string, error) {
+	mode, exists := container.Labels["virtual.upstream"]
+	if !exists {
+		mode = g.config.Upstream
+	}
+	name := strings.TrimPrefix(container.Names[0], "/")
+
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", config.UpstreamIP:
+		return g.containerIPs(container, networkSettings)
+	case config.UpstreamName:
+		return name, "", nil
+	case config.UpstreamService:
+		service := container.Labels[composeServiceLabel]
+		if service == "" {
+			return "", "", fmt.Errorf("container is not a compose service")
+		}
+		return service, "", nil
+	case config.UpstreamAlias:
+		// Aliases include the short container ID, which is not meaningful as an upstream
+		for _, alias := range networkSettings.Aliases {
+			if alias != "" && !strings.HasPrefix(container.ID, alias) {
+				return alias, "", nil
+			}
+		}
+		if service := container.Labels[composeServiceLabel]; service != "" {
+			return service, "", nil
+		}
+		return name, "", nil
+	}
+	return "", "", fmt.Errorf("unknown upstream mode %s", mode)
+}
+
+// containerIPs selects the container IPs by the virtual.ip_family label or the default preference,
+// falling back to the other family if the preferred one has no address
+func (g *Generator) containerIPs(container types.Container, networkSettings *network.EndpointSettings) (string, string, error) {
+	family, exists := container.Labels["virtual.ip_family"]
+	if !exists {
+		family = g.config.IPFamily
+	}
+	ipv4, ipv6 := networkSettings.IPAddress, networkSettings.GlobalIPv6Address
+
+	switch strings.ToLower(strings.TrimSpace(family)) {
+	case "", config.IPFamilyV4:
+		if ipv4 == "" {
+			return ipv6, "", nil
+		}
+		return ipv4, "", nil
+	case config.IPFamilyV6:
+		if ipv6 == "" {
+			return ipv4, "", nil
+		}
+		return ipv6, "", nil
+	case config.IPFamilyDual:
+		if ipv4 == "" {
+			return ipv6, "", nil
+		}
+		return ipv4, ipv6, nil
+	}
+	return "", "", fmt.Errorf("unknown IP family %s", family)
+}
@@ -0,0 +1,161 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+)
+
+func TestContainerAddress(t *testing.T) {
+	container := types.Container{
+		ID:     "0123456789abcdef",
+		Names:  []string{"/project-web-1"},
+		Labels: map[string]string{composeServiceLabel: "web"},
+	}
+	networkSettings := &network.EndpointSettings{
+		IPAddress: "172.17.0.2",
+		Aliases:   []string{"0123456789ab", "frontend"},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Upstream: config.UpstreamIP}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	tests := map[string]string{
+		config.UpstreamIP:      "172.17.0.2",
+		config.UpstreamName:    "project-web-1",
+		config.UpstreamService: "web",
+		config.UpstreamAlias:   "frontend",
+	}
+	for mode, want := range tests {
+		container.Labels["virtual.upstream"] = mode
+		if got, _, err := generator.containerAddress(container, networkSettings); err != nil || got != want {
+			t.Errorf("containerAddress(%s) = %s, %v; want %s", mode, got, err, want)
+		}
+	}
+
+	// Alias falls back to the compose service
+	container.Labels["virtual.upstream"] = config.UpstreamAlias
+	networkSettings.Aliases = []string{"0123456789ab"}
+	if got, _, _ := generator.containerAddress(container, networkSettings); got != "web" {
+		t.Errorf("containerAddress(alias) = %s; want web", got)
+	}
+
+	// Service mode requires a compose service
+	delete(container.Labels, composeServiceLabel)
+	container.Labels["virtual.upstream"] = config.UpstreamService
+	if _, _, err := generator.containerAddress(container, networkSettings); err == nil {
+		t.Error("containerAddress(service) error = nil; want error without compose service")
+	}
+}
+
+func TestSkipUnreachableContainer(t *testing.T) {
+	container := types.Container{
+		Names:           []string{"/web"},
+		State:           "running",
+		Labels:          map[string]string{"virtual.bind": "80 example.com"},
+		NetworkSettings: &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{}},
+	}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	if configs := generator.processSiteConfigs(config.HostConfig{}, []types.Container{container}); len(configs) != 0 {
+		t.Errorf("processSiteConfigs() = %+v; want container without address skipped", configs)
+	}
+	want := "web: resolving address for example.com: no reachable address on networks [gateway]"
+	if problems := generator.Problems(); len(problems) != 1 || problems[0].String() != want {
+		t.Errorf("Problems() = %v; want %s", problems, want)
+	}
+}
+
+func TestUseHostAddress(t *testing.T) {
+	containers := []types.Container{
+		{
+			Names:  []string{"/legacy"},
+			State:  "running",
+			Labels: map[string]string{"virtual.bind": "8080 legacy.example.com"},
+			Ports:  []types.Port{{IP: "0.0.0.0", PrivatePort: 8080, PublicPort: 18080, Type: "tcp"}},
+		},
+		{
+			Names:  []string{"/bound"},
+			State:  "running",
+			Labels: map[string]string{"virtual.bind": "80 bound.example.com"},
+			Ports:  []types.Port{{IP: "192.168.1.5", PrivatePort: 80, PublicPort: 8000, Type: "tcp"}},
+		},
+		{
+			Names:  []string{"/hostnet"},
+			State:  "running",
+			Labels: map[string]string{"virtual.bind": "9000 hostnet.example.com"},
+		},
+		{
+			Names:  []string{"/local"},
+			State:  "running",
+			Labels: map[string]string{"virtual.bind": "80 local.example.com"},
+			Ports: []types.Port{
+				{IP: "127.0.0.1", PrivatePort: 80, PublicPort: 8001, Type: "tcp"},
+				{IP: "::1", PrivatePort: 80, PublicPort: 8001, Type: "tcp"},
+			},
+		},
+	}
+	containers[2].HostConfig.NetworkMode = "host"
+
+	cfg := &config.Config{Networks: []string{"gateway"}, Published: true, HostGateway: "host.docker.internal"}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	// Ports published on loopback addresses only are skipped
+	configs := generator.processSiteConfigs(config.HostConfig{}, containers)
+	if len(configs) != 3 {
+		t.Fatalf("processSiteConfigs() returned %d configs; want 3 without the loopback-bound port", len(configs))
+	}
+	if problems := generator.Problems(); len(problems) != 1 || problems[0].Name != "local" {
+		t.Errorf("Problems() = %v; want the loopback-bound port of local", problems)
+	}
+	want := []string{"host.docker.internal:18080", "192.168.1.5:8000", "host.docker.internal:9000"}
+	for i, site := range configs {
+		if site.Upstream() != want[i] {
+			t.Errorf("configs[%d].Upstream() = %s; want %s", i, site.Upstream(), want[i])
+		}
+	}
+
+	// Containers outside the networks are skipped unless enabled
+	cfg.Published = false
+	if configs := generator.processSiteConfigs(config.HostConfig{}, containers); len(configs) != 0 {
+		t.Errorf("processSiteConfigs() returned %d configs; want 0 when disabled", len(configs))
+	}
+}
+
+func TestContainerIPs(t *testing.T) {
+	container := types.Container{Names: []string{"/web"}, Labels: map[string]string{}}
+	dualStack := &network.EndpointSettings{IPAddress: "172.17.0.2", GlobalIPv6Address: "fd00::2"}
+	ipv6Only := &network.EndpointSettings{GlobalIPv6Address: "fd00::3"}
+
+	cfg := &config.Config{Networks: []string{"gateway"}}
+	generator := NewGenerator([]*docker.Client{{}}, cfg)
+
+	tests := []struct {
+		family          string
+		settings        *network.EndpointSettings
+		primary, second string
+	}{
+		{config.IPFamilyV4, dualStack, "172.17.0.2", ""},
+		{config.IPFamilyV6, dualStack, "fd00::2", ""},
+		{config.IPFamilyDual, dualStack, "172.17.0.2", "fd00::2"},
+		{config.IPFamilyV4, ipv6Only, "fd00::3", ""},
+		{config.IPFamilyDual, ipv6Only, "fd00::3", ""},
+	}
+	for _, test := range tests {
+		cfg.IPFamily = test.family
+		primary, second, err := generator.containerIPs(container, test.settings)
+		if err != nil || primary != test.primary || second != test.second {
+			t.Errorf("containerIPs(%s) = %s, %s, %v; want %s, %s", test.family, primary, second, err, test.primary, test.second)
+		}
+	}
+
+	site := SiteConfig{ProxyIP: "172.17.0.2", ProxyIPv6: "fd00::2", Port: 80}
+	if upstreams := site.Upstreams(); len(upstreams) != 2 || upstreams[1] != "[fd00::2]:80" {
+		t.Errorf("Upstreams() = %v; want bracketed IPv6 upstream", upstreams)
+	}
+}
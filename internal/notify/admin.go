@@ -0,0 +1,205 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/generator"
+)
+
+// DefaultAdminID is the @id of the caddy-gen server when patching
+const DefaultAdminID = "caddy-gen"
+
+// adminEndpoint is a resolved Caddy admin API address
+type adminEndpoint struct {
+	address string
+	baseURL string
+	client  *http.Client
+}
+
+// AdminNotifier pushes the generated config to Caddy's admin API
+type AdminNotifier struct {
+	config    *config.AdminConfig
+	format    string
+	endpoints []adminEndpoint
+}
+
+// NewAdminNotifier creates a new AdminNotifier for the output format and Caddyfile layout
+func NewAdminNotifier(cfg *config.AdminConfig, format, layout string) (*AdminNotifier, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.New("no admin endpoints configured")
+	}
+
+	switch cfg.Mode {
+	case "", config.AdminModeLoad:
+		// Load replaces Caddy's whole config, which handle blocks cannot be on their own
+		if format == config.FormatCaddyfile && layout != config.LayoutSite {
+			return nil, fmt.Errorf("admin mode %s requires %s layout or %s format", config.AdminModeLoad, config.LayoutSite, config.FormatJSON)
+		}
+	case config.AdminModePatch:
+		if format != config.FormatJSON {
+			return nil, fmt.Errorf("admin mode %s requires %s format", config.AdminModePatch, config.FormatJSON)
+		}
+	default:
+		return nil, fmt.Errorf("unknown admin mode: %s", cfg.Mode)
+	}
+
+	n := &AdminNotifier{
+		config: cfg,
+		format: format,
+	}
+	for _, address := range cfg.Endpoints {
+		n.endpoints = append(n.endpoints, newAdminEndpoint(address))
+	}
+	return n, nil
+}
+
+// newAdminEndpoint resolves an admin address to a base URL and an HTTP client
+func newAdminEndpoint(address string) adminEndpoint {
+	endpoint := adminEndpoint{
+		address: address,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+
+	// Caddy writes unix socket addresses as unix//path/to/socket
+	if strings.HasPrefix(address, "unix/") {
+		socket := strings.TrimPrefix(address, "unix/")
+		endpoint.baseURL = "http://localhost"
+		endpoint.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return endpoint
+	}
+
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	endpoint.baseURL = strings.TrimRight(address, "/")
+	return endpoint
+}
+
+// AdminResult is the outcome of pushing the config to one admin endpoint
+type AdminResult struct {
+	Endpoint string
+	Err      error
+}
+
+// AdminError reports the admin endpoints that did not accept the config
+type AdminError struct {
+	Results []AdminResult // Results of all endpoints, including the successful ones
+}
+
+func (e *AdminError) Error() string {
+	var failures []string
+	for _, result := range e.Results {
+		if result.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", result.Endpoint, result.Err))
+		}
+	}
+	return fmt.Sprintf("failed to push config to %d of %d admin endpoints: %s", len(failures), len(e.Results), strings.Join(failures, "; "))
+}
+
+// Notify sends the config to all admin endpoints and reports the endpoints that failed
+func (n *AdminNotifier) Notify(update Update) error {
+	method, path, contentType, body, err := n.buildRequest(update.Content)
+	if err != nil {
+		return err
+	}
+
+	var results []AdminResult
+	failed := false
+	for _, endpoint := range n.endpoints {
+		err := n.send(endpoint, method, path, contentType, body)
+		if err != nil {
+			log.Printf("Failed to push config to %s: %v", endpoint.address, err)
+			failed = true
+		} else {
+			log.Printf("Caddy config pushed to %s%s", endpoint.address, path)
+		}
+		results = append(results, AdminResult{Endpoint: endpoint.address, Err: err})
+	}
+
+	if failed {
+		return &AdminError{Results: results}
+	}
+	return nil
+}
+
+// buildRequest builds the method, path, content type and body for the configured mode
+func (n *AdminNotifier) buildRequest(content string) (string, string, string, []byte, error) {
+	if n.config.Mode == config.AdminModePatch {
+		id := n.config.ID
+		if id == "" {
+			id = DefaultAdminID
+		}
+		body, err := extractServer(content, id)
+		if err != nil {
+			return "", "", "", nil, err
+		}
+		return http.MethodPatch, "/id/" + id, "application/json", body, nil
+	}
+
+	contentType := "text/caddyfile"
+	if n.format == config.FormatJSON {
+		contentType = "application/json"
+	}
+	return http.MethodPost, "/load", contentType, []byte(content), nil
+}
+
+// extractServer extracts the caddy-gen server from a JSON config and tags it with the @id
+func extractServer(content string, id string) ([]byte, error) {
+	var root struct {
+		Apps struct {
+			HTTP struct {
+				Servers map[string]map[string]interface{} `json:"servers"`
+			} `json:"http"`
+		} `json:"apps"`
+	}
+	if err := json.Unmarshal([]byte(content), &root); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON config: %v", err)
+	}
+
+	server, exists := root.Apps.HTTP.Servers[generator.JSONServerName]
+	if !exists {
+		return nil, fmt.Errorf("server %s not found in JSON config", generator.JSONServerName)
+	}
+	server["@id"] = id
+	return json.Marshal(server)
+}
+
+// send sends a single request to an admin endpoint and checks the response status
+func (n *AdminNotifier) send(endpoint adminEndpoint, method, path, contentType string, body []byte) error {
+	req, err := http.NewRequest(method, endpoint.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range n.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := endpoint.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("reload failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+func TestAdminNotifierLoad(t *testing.T) {
+	var method, path, contentType, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		contentType, auth = r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	notifier, err := NewAdminNotifier(&config.AdminConfig{
+		Endpoints: []string{server.URL},
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+	}, config.FormatCaddyfile, config.LayoutSite)
+	if err != nil {
+		t.Fatalf("NewAdminNotifier() error = %v", err)
+	}
+
+	if err := notifier.Notify(Update{Content: "example.com {\n}"}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if method != http.MethodPost || path != "/load" || contentType != "text/caddyfile" {
+		t.Errorf("request = %s %s (%s); want POST /load (text/caddyfile)", method, path, contentType)
+	}
+	if auth != "Bearer token" || body != "example.com {\n}" {
+		t.Errorf("auth = %q, body = %q; want header and config forwarded", auth, body)
+	}
+}
+
+func TestAdminNotifierPatch(t *testing.T) {
+	var method, path string
+	var server map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&server)
+	}))
+	defer ts.Close()
+
+	notifier, err := NewAdminNotifier(&config.AdminConfig{
+		Endpoints: []string{ts.URL},
+		Mode:      config.AdminModePatch,
+	}, config.FormatJSON, config.LayoutHandle)
+	if err != nil {
+		t.Fatalf("NewAdminNotifier() error = %v", err)
+	}
+
+	content := `{"apps":{"http":{"servers":{"caddy-gen":{"listen":[":443"],"routes":[]}}}}}`
+	if err := notifier.Notify(Update{Content: content}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if method != http.MethodPatch || path != "/id/caddy-gen" {
+		t.Errorf("request = %s %s; want PATCH /id/caddy-gen", method, path)
+	}
+	if server["@id"] != "caddy-gen" || server["listen"] == nil {
+		t.Errorf("patched server = %v; want tagged caddy-gen server", server)
+	}
+}
+
+func TestAdminNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "adapting config failed", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	notifier, err := NewAdminNotifier(&config.AdminConfig{Endpoints: []string{server.URL}}, config.FormatCaddyfile, config.LayoutSite)
+	if err != nil {
+		t.Fatalf("NewAdminNotifier() error = %v", err)
+	}
+	if err := notifier.Notify(Update{Content: "invalid"}); err == nil {
+		t.Error("Notify() error = nil; want reload failure")
+	}
+
+	// Every endpoint is pushed to, and the error has the result of each one
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	notifier, err = NewAdminNotifier(&config.AdminConfig{Endpoints: []string{ok.URL, server.URL}}, config.FormatCaddyfile, config.LayoutSite)
+	if err != nil {
+		t.Fatalf("NewAdminNotifier() error = %v", err)
+	}
+	var adminErr *AdminError
+	if err := notifier.Notify(Update{Content: "a.com {\n}"}); !errors.As(err, &adminErr) {
+		t.Fatalf("Notify() error = %v; want *AdminError", err)
+	}
+	if len(adminErr.Results) != 2 || adminErr.Results[0].Err != nil || adminErr.Results[1].Err == nil {
+		t.Errorf("Notify() results = %+v; want the first endpoint accepted and the second failed", adminErr.Results)
+	}
+
+	if _, err := NewAdminNotifier(&config.AdminConfig{Endpoints: []string{server.URL}, Mode: config.AdminModePatch}, config.FormatCaddyfile, config.LayoutSite); err == nil {
+		t.Error("NewAdminNotifier() error = nil; want error for patch mode with caddyfile format")
+	}
+	if _, err := NewAdminNotifier(&config.AdminConfig{Endpoints: []string{server.URL}}, config.FormatCaddyfile, config.LayoutHandle); err == nil {
+		t.Error("NewAdminNotifier() error = nil; want error for load mode with handle blocks")
+	}
+	if _, err := NewAdminNotifier(&config.AdminConfig{Endpoints: []string{server.URL}}, config.FormatJSON, config.LayoutHandle); err != nil {
+		t.Errorf("NewAdminNotifier() error = %v; want load mode allowed with JSON format", err)
+	}
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/gera2ld/caddy-gen/internal/generator"
+)
+
+// Notifier tells a consumer that a new configuration has been written
+type Notifier interface {
+	Notify(update Update) error
+}
+
+// Update is a configuration change passed to notifiers
+type Update struct {
+	Content  string                 // Generated configuration
+	Previous []generator.SiteConfig // Sites of the configuration applied before
+	Sites    []generator.SiteConfig // Sites of the generated configuration
+}
+
+// Hash returns the SHA-256 of the generated configuration
+func (u Update) Hash() string {
+	sum := sha256.Sum256([]byte(u.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentFunc adapts a function that only needs the generated configuration to a Notifier
+type ContentFunc func(content string) error
+
+// Notify calls the function with the generated configuration
+func (f ContentFunc) Notify(update Update) error {
+	return f(update.Content)
+}
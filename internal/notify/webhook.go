@@ -0,0 +1,253 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/generator"
+)
+
+// Webhook defaults
+const (
+	defaultWebhookTimeout  = 10 * time.Second
+	defaultWebhookAttempts = 3
+	defaultWebhookBackoff  = time.Second
+)
+
+// SignatureHeader holds the HMAC-SHA256 signature of the body, as sha256=<hex>
+const SignatureHeader = "X-Caddy-Gen-Signature"
+
+// WebhookPayload is the JSON body posted to webhooks
+type WebhookPayload struct {
+	Event        string        `json:"event"`
+	Time         time.Time     `json:"time"`
+	Hash         string        `json:"hash"` // SHA-256 of the generated config
+	Format       string        `json:"format"`
+	ChangedHosts []string      `json:"changedHosts"`
+	Added        []WebhookSite `json:"added"`
+	Removed      []WebhookSite `json:"removed"`
+	Modified     []WebhookSite `json:"modified"`
+	Config       string        `json:"config,omitempty"`
+}
+
+// WebhookSite is a site of a container or service in a webhook payload
+type WebhookSite struct {
+	Name      string   `json:"name"`
+	Source    string   `json:"source,omitempty"`
+	Hostnames []string `json:"hostnames"`
+	Path      string   `json:"path,omitempty"`
+	Upstreams []string `json:"upstreams"`
+}
+
+// webhook is a resolved webhook endpoint
+type webhook struct {
+	config   config.WebhookConfig
+	attempts int
+	client   *http.Client
+}
+
+// WebhookNotifier posts config changes to HTTP endpoints
+type WebhookNotifier struct {
+	webhooks []webhook
+	format   string
+	backoff  time.Duration // Delay before the first retry, doubled for each further retry
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier
+func NewWebhookNotifier(cfgs []config.WebhookConfig, format string) (*WebhookNotifier, error) {
+	notifier := &WebhookNotifier{format: format, backoff: defaultWebhookBackoff}
+	for _, cfg := range cfgs {
+		if parsed, err := url.Parse(cfg.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("invalid webhook URL %q", cfg.URL)
+		}
+
+		timeout := defaultWebhookTimeout
+		if cfg.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid timeout of webhook %s: %v", cfg.URL, err)
+			}
+		}
+		attempts := cfg.Attempts
+		if attempts <= 0 {
+			attempts = defaultWebhookAttempts
+		}
+
+		notifier.webhooks = append(notifier.webhooks, webhook{
+			config:   cfg,
+			attempts: attempts,
+			client:   &http.Client{Timeout: timeout},
+		})
+	}
+	return notifier, nil
+}
+
+// Notify posts the changes to all webhooks
+func (n *WebhookNotifier) Notify(update Update) error {
+	payload := n.buildPayload(update)
+
+	var errs []error
+	for _, hook := range n.webhooks {
+		payload.Config = ""
+		if hook.config.IncludeConfig {
+			payload.Config = update.Content
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook payload: %v", err)
+		}
+
+		if err := n.send(hook, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", hook.config.URL, err))
+			continue
+		}
+		log.Printf("Webhook notified: %s", hook.config.URL)
+	}
+	return errors.Join(errs...)
+}
+
+// buildPayload builds the payload of an update, without the config
+func (n *WebhookNotifier) buildPayload(update Update) WebhookPayload {
+	payload := WebhookPayload{
+		Event:        "config_changed",
+		Time:         time.Now().UTC(),
+		Hash:         update.Hash(),
+		Format:       n.format,
+		ChangedHosts: []string{},
+		Added:        []WebhookSite{},
+		Removed:      []WebhookSite{},
+		Modified:     []WebhookSite{},
+	}
+
+	previous, current := groupWebhookSites(update.Previous), groupWebhookSites(update.Sites)
+	hosts := make(map[string]bool)
+	addSite := func(list *[]WebhookSite, sites []generator.SiteConfig) {
+		site := newWebhookSite(sites)
+		*list = append(*list, site)
+		for _, hostname := range site.Hostnames {
+			hosts[hostname] = true
+		}
+	}
+
+	for _, key := range sortedKeys(current) {
+		if sites, exists := previous[key]; !exists {
+			addSite(&payload.Added, current[key])
+		} else if !reflect.DeepEqual(sites, current[key]) {
+			addSite(&payload.Modified, current[key])
+		}
+	}
+	for _, key := range sortedKeys(previous) {
+		if _, exists := current[key]; !exists {
+			addSite(&payload.Removed, previous[key])
+		}
+	}
+
+	for hostname := range hosts {
+		payload.ChangedHosts = append(payload.ChangedHosts, hostname)
+	}
+	sort.Strings(payload.ChangedHosts)
+	return payload
+}
+
+// groupWebhookSites groups sites by name, source, hostnames and path, so the upstreams of a
+// swarm service or a dual stack container form one site
+func groupWebhookSites(sites []generator.SiteConfig) map[string][]generator.SiteConfig {
+	groups := make(map[string][]generator.SiteConfig)
+	for _, site := range sites {
+		key := strings.Join([]string{site.Name, site.Source, strings.Join(site.Hostnames, " "), site.PathMatcher}, "\x00")
+		groups[key] = append(groups[key], site)
+	}
+	return groups
+}
+
+// newWebhookSite summarizes a group of sites
+func newWebhookSite(sites []generator.SiteConfig) WebhookSite {
+	site := WebhookSite{
+		Name:      sites[0].Name,
+		Source:    sites[0].Source,
+		Hostnames: sites[0].Hostnames,
+		Path:      sites[0].PathMatcher,
+		Upstreams: []string{},
+	}
+	for _, item := range sites {
+		site.Upstreams = append(site.Upstreams, item.Upstreams()...)
+	}
+	return site
+}
+
+// sortedKeys returns the keys of site groups in sorted order
+func sortedKeys(groups map[string][]generator.SiteConfig) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// send posts a body to a webhook, retrying network errors and 5xx or 429 responses with backoff
+func (n *WebhookNotifier) send(hook webhook, body []byte) error {
+	delay := n.backoff
+	var err error
+	for attempt := 1; attempt <= hook.attempts; attempt++ {
+		var retry bool
+		if retry, err = n.post(hook, body); err == nil || !retry {
+			return err
+		}
+		if attempt < hook.attempts {
+			log.Printf("Webhook %s failed, retrying in %v: %v", hook.config.URL, delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %v", hook.attempts, err)
+}
+
+// post sends a single request and reports whether a failure may be retried
+func (n *WebhookNotifier) post(hook webhook, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.config.Headers {
+		req.Header.Set(key, value)
+	}
+	if hook.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.config.Secret, body))
+	}
+
+	resp, err := hook.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return false, nil
+}
+
+// Sign returns the signature header value of a body, as sha256=<hex of HMAC-SHA256>
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
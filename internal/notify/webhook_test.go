@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/generator"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var requests int
+	var signature string
+	var payload WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		if got := Sign("secret", body); got != signature {
+			t.Errorf("signature = %s; want %s", signature, got)
+		}
+		json.Unmarshal(body, &payload)
+	}))
+	defer server.Close()
+
+	notifier, err := NewWebhookNotifier([]config.WebhookConfig{{
+		URL:           server.URL,
+		Secret:        "secret",
+		IncludeConfig: true,
+	}}, config.FormatCaddyfile)
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier() error = %v", err)
+	}
+	notifier.backoff = time.Millisecond
+
+	previous := []generator.SiteConfig{
+		{Hostnames: []string{"a.example.com"}, Port: 80, Name: "a", ProxyIP: "172.17.0.2"},
+		{Hostnames: []string{"b.example.com"}, Port: 80, Name: "b", ProxyIP: "172.17.0.3"},
+		{Hostnames: []string{"c.example.com"}, Port: 80, Name: "c", ProxyIP: "172.17.0.4"},
+	}
+	sites := []generator.SiteConfig{
+		{Hostnames: []string{"a.example.com"}, Port: 80, Name: "a", ProxyIP: "172.17.0.2"},
+		{Hostnames: []string{"b.example.com"}, Port: 80, Name: "b", ProxyIP: "172.17.0.5"},
+		{Hostnames: []string{"d.example.com"}, Port: 80, PathMatcher: "/api/*", Name: "d", ProxyIP: "10.0.0.2"},
+		{Hostnames: []string{"d.example.com"}, Port: 80, PathMatcher: "/api/*", Name: "d", ProxyIP: "10.0.0.3"},
+	}
+	update := Update{Content: "config", Previous: previous, Sites: sites}
+	if err := notifier.Notify(update); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("requests = %d; want a retry after 503", requests)
+	}
+	if payload.Hash != update.Hash() || payload.Config != "config" || payload.Format != config.FormatCaddyfile {
+		t.Errorf("payload = %+v; want hash, config and format", payload)
+	}
+	if want := []string{"b.example.com", "c.example.com", "d.example.com"}; !reflect.DeepEqual(payload.ChangedHosts, want) {
+		t.Errorf("payload.ChangedHosts = %v; want %v", payload.ChangedHosts, want)
+	}
+	added := []WebhookSite{{Name: "d", Hostnames: []string{"d.example.com"}, Path: "/api/*", Upstreams: []string{"10.0.0.2:80", "10.0.0.3:80"}}}
+	modified := []WebhookSite{{Name: "b", Hostnames: []string{"b.example.com"}, Upstreams: []string{"172.17.0.5:80"}}}
+	removed := []WebhookSite{{Name: "c", Hostnames: []string{"c.example.com"}, Upstreams: []string{"172.17.0.4:80"}}}
+	if !reflect.DeepEqual(payload.Added, added) || !reflect.DeepEqual(payload.Modified, modified) || !reflect.DeepEqual(payload.Removed, removed) {
+		t.Errorf("payload sites = %+v, %+v, %+v; want d added, b modified, c removed", payload.Added, payload.Modified, payload.Removed)
+	}
+}
+
+func TestWebhookNotifierGivesUp(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		status := http.StatusBadGateway
+		if r.Header.Get("X-Fail") == "client" {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, "failed", status)
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		fail     string
+		requests int
+	}{
+		{"server", 2},
+		{"client", 1}, // Client errors are not retried
+	} {
+		requests = 0
+		notifier, err := NewWebhookNotifier([]config.WebhookConfig{{
+			URL:      server.URL,
+			Headers:  map[string]string{"X-Fail": tt.fail},
+			Attempts: 2,
+		}}, config.FormatJSON)
+		if err != nil {
+			t.Fatalf("NewWebhookNotifier() error = %v", err)
+		}
+		notifier.backoff = time.Millisecond
+
+		if err := notifier.Notify(Update{Content: "{}"}); err == nil || requests != tt.requests {
+			t.Errorf("Notify() error = %v after %d requests; want failure after %d", err, requests, tt.requests)
+		}
+	}
+
+	if _, err := NewWebhookNotifier([]config.WebhookConfig{{URL: "ftp://example.com"}}, config.FormatJSON); err == nil {
+		t.Error("NewWebhookNotifier() error = nil; want invalid URL")
+	}
+}
@@ -1,77 +1,307 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/gera2ld/caddy-gen/internal/config"
 	"github.com/gera2ld/caddy-gen/internal/docker"
 	"github.com/gera2ld/caddy-gen/internal/generator"
+	"github.com/gera2ld/caddy-gen/internal/notify"
+	"github.com/gera2ld/caddy-gen/internal/validate"
 )
 
 // Service is the main service
 type Service struct {
-	docker    *docker.Client
+	clients   []*docker.Client
 	generator *generator.Generator
 	config    *config.Config
+	notifiers []notify.Notifier // Reload Caddy, a change is rolled back if none of them succeeds
+	webhooks  notify.Notifier   // Told about applied changes in the background, nil without webhooks
+	mu        sync.Mutex        // Guards the fields, held while applying a config
+	// generating serializes config generations triggered by several hosts, without holding mu
+	// while probing upstreams
+	generating sync.Mutex
+	recheck    *time.Timer
+	status     Status // Outcome of the last config change
+	// appliedSites holds the sites of the config Caddy runs, to report changes to notifiers
+	appliedSites []generator.SiteConfig
+	stopWatch    context.CancelFunc // Stops watching the events of the current clients
+	failedHash   string             // Hash of the last rejected or rolled back config
+	// retryAt is when a rolled back config is tried again, after retryDelay, zero for rejected
+	// configs that fail the same way every time
+	retryAt    time.Time
+	retryDelay time.Duration
+	// delivered is closed once the last queued webhook delivery is done, so deliveries keep their order
+	delivered  chan struct{}
+	deliveries sync.WaitGroup
 }
 
-// NewService creates a new Service
-func NewService() (*Service, error) {
-	// Create config
-	cfg := config.NewConfig()
+// recheckInterval is the delay before regenerating while sites are held back by readiness gating
+const recheckInterval = 5 * time.Second
+
+// Delays before retrying a rolled back config, doubled after each failed retry
+const (
+	minRetryDelay = 10 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
 
-	// Create Docker client
-	dockerClient, err := docker.NewClient(cfg)
+// NewService creates a new Service
+func NewService(cfg *config.Config) (*Service, error) {
+	// Create Docker clients
+	clients, err := docker.NewClients(cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create generator
-	gen := generator.NewGenerator(dockerClient, cfg)
+	gen := generator.NewGenerator(clients, cfg)
+
+	// Create notifiers, Caddy containers are notified on the first host
+	notifiers, webhooks, err := newNotifiers(cfg, clients[0])
+	if err != nil {
+		closeClients(clients)
+		return nil, err
+	}
 
 	return &Service{
-		docker:    dockerClient,
+		clients:   clients,
 		generator: gen,
 		config:    cfg,
+		notifiers: notifiers,
+		webhooks:  webhooks,
 	}, nil
 }
 
-// Close closes the service
+// newNotifiers creates the notifiers reloading Caddy and the webhook notifier enabled in the
+// configuration
+func newNotifiers(cfg *config.Config, dockerClient *docker.Client) ([]notify.Notifier, notify.Notifier, error) {
+	var notifiers []notify.Notifier
+	if cfg.Notify == nil {
+		return notifiers, nil, nil
+	}
+
+	if cfg.Notify.HasTargets() {
+		notifiers = append(notifiers, notify.ContentFunc(dockerClient.Notify))
+	}
+
+	if cfg.Notify.Admin != nil {
+		adminNotifier, err := notify.NewAdminNotifier(cfg.Notify.Admin, cfg.Format, cfg.Layout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create admin notifier: %v", err)
+		}
+		notifiers = append(notifiers, adminNotifier)
+	}
+
+	if len(cfg.Notify.Webhooks) == 0 {
+		return notifiers, nil, nil
+	}
+	webhookNotifier, err := notify.NewWebhookNotifier(cfg.Notify.Webhooks, cfg.Format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create webhook notifier: %v", err)
+	}
+	return notifiers, webhookNotifier, nil
+}
+
+// Reload swaps in new settings and regenerates the config. The clients and notifiers of the new
+// settings are created first, so the current settings are kept if they cannot be used.
+func (s *Service) Reload(cfg *config.Config) error {
+	next, err := NewService(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	previous := s.clients
+	s.clients, s.generator, s.config = next.clients, next.generator, next.config
+	s.notifiers, s.webhooks = next.notifiers, next.webhooks
+	s.failedHash, s.retryAt = "", time.Time{} // New settings may accept the config that failed
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	s.mu.Unlock()
+
+	closeClients(previous)
+	log.Println("Settings reloaded, regenerating config")
+	s.CheckConfig()
+	return nil
+}
+
+// Close waits for pending webhook deliveries and closes the service
 func (s *Service) Close() error {
-	return s.docker.Close()
+	s.deliveries.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return closeClients(s.clients)
+}
+
+// closeClients closes all Docker clients and returns the first error
+func closeClients(clients []*docker.Client) error {
+	var firstErr error
+	for _, dockerClient := range clients {
+		if err := dockerClient.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
-// Run runs the service
-func (s *Service) Run() error {
+// Run runs the service until the context is done
+func (s *Service) Run(ctx context.Context) error {
 	// Initial config check
 	s.CheckConfig()
 
-	// Watch for Docker events
+	// Watch for Docker events on all hosts, starting over with the new clients after a reload
 	log.Println("Waiting for Docker events...")
-	s.docker.WatchEvents(s.CheckConfig)
+	for ctx.Err() == nil {
+		s.watchEvents(ctx)
+	}
 
 	return nil
 }
 
+// watchEvents watches Docker events on all hosts until the context is done or the settings are reloaded
+func (s *Service) watchEvents(ctx context.Context) {
+	s.mu.Lock()
+	clients := s.clients
+	watchCtx, cancel := context.WithCancel(ctx)
+	s.stopWatch = cancel
+	s.mu.Unlock()
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, dockerClient := range clients {
+		wg.Add(1)
+		go func(dockerClient *docker.Client) {
+			defer wg.Done()
+			dockerClient.WatchEvents(watchCtx, s.CheckConfig)
+		}(dockerClient)
+	}
+	wg.Wait()
+}
+
 // CheckConfig checks and updates the configuration
 func (s *Service) CheckConfig() {
-	// Read current config
-	currentConfig := s.readCurrentConfig()
+	// Errors are logged and the next event or recheck tries again
+	s.updateConfig(true)
+}
+
+// Once checks and updates the configuration a single time, without rechecking sites that are
+// not ready yet, and returns why a changed config was not applied
+func (s *Service) Once() error {
+	return s.updateConfig(false)
+}
+
+// Generator returns the generator of the current settings
+func (s *Service) Generator() *generator.Generator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generator
+}
+
+// updateConfig generates the configuration and applies it if it changed, and with recheck
+// regenerates it later while sites are not ready. Generating probes upstreams, so it runs
+// outside s.mu and only generations are serialized.
+func (s *Service) updateConfig(recheck bool) error {
+	s.generating.Lock()
+	defer s.generating.Unlock()
+
+	s.mu.Lock()
+	gen := s.generator
+	s.mu.Unlock()
 
 	// Generate new config
-	newConfig, err := s.generator.GenerateConfig()
+	newConfig, err := gen.GenerateConfig()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen != s.generator {
+		// Reload checks again with the new settings
+		log.Println("Settings reloaded while generating, skip applying")
+		return nil
+	}
+	if recheck {
+		defer s.scheduleRecheck()
+	}
 	if err != nil {
 		log.Printf("Failed to generate config: %v", err)
-		return
+		return fmt.Errorf("failed to generate config: %v", err)
 	}
 
-	// Write new config if changed
-	if currentConfig != newConfig {
-		s.writeNewConfig(newConfig)
-	} else {
+	return s.changeConfig(newConfig, s.readCurrentConfig(), gen.Sites())
+}
+
+// changeConfig writes a generated config if it changed and is accepted by Caddy, keeping the
+// previous file otherwise. A rejected config is not tried again until the generated config
+// changes, and a rolled back one only after a backoff, so every event does not reload Caddy
+// with it while a failure that may be temporary is still retried.
+func (s *Service) changeConfig(newConfig, currentConfig string, sites []generator.SiteConfig) error {
+	if currentConfig == newConfig {
 		log.Println("No change, skip notifying")
+		s.appliedSites = sites
+		s.failedHash, s.retryAt = "", time.Time{}
+		return nil
+	}
+	hash := configHash(newConfig)
+	if hash == s.failedHash && (s.retryAt.IsZero() || time.Now().Before(s.retryAt)) {
+		log.Println("Generated config was rejected or rolled back before, skip applying it for now")
+		return nil
+	}
+
+	if err := s.ValidateConfig(newConfig); err != nil {
+		log.Printf("Rejected generated config, keeping %s: %v", s.config.OutFile, err)
+		s.writeRejectedConfig(newConfig)
+		s.reportStatus(ResultRejected, newConfig, err)
+		s.failedHash, s.retryAt = hash, time.Time{}
+		return err
+	}
+	err := s.applyConfig(newConfig, currentConfig, sites)
+	if s.status.Result != ResultRolledBack {
+		s.failedHash, s.retryAt = "", time.Time{}
+		return err
+	}
+
+	// Back off while the same config keeps failing
+	if hash != s.failedHash || s.retryDelay == 0 {
+		s.retryDelay = minRetryDelay
+	} else if s.retryDelay *= 2; s.retryDelay > maxRetryDelay {
+		s.retryDelay = maxRetryDelay
+	}
+	s.failedHash, s.retryAt = hash, time.Now().Add(s.retryDelay)
+	return err
+}
+
+// scheduleRecheck regenerates the config later while sites wait for readiness or a rolled back
+// config waits to be retried
+func (s *Service) scheduleRecheck() {
+	if s.recheck != nil {
+		s.recheck.Stop()
+		s.recheck = nil
+	}
+
+	var delay time.Duration
+	if pending := s.generator.Pending(); pending > 0 {
+		log.Printf("%d sites are not ready, checking again in %v", pending, recheckInterval)
+		delay = recheckInterval
+	}
+	if !s.retryAt.IsZero() {
+		retry := time.Until(s.retryAt)
+		if retry < recheckInterval {
+			retry = recheckInterval
+		}
+		log.Printf("Retrying the rolled back config in %v", retry.Round(time.Second))
+		if delay == 0 || retry < delay {
+			delay = retry
+		}
+	}
+	if delay > 0 {
+		s.recheck = time.AfterFunc(delay, s.CheckConfig)
 	}
 }
 
@@ -87,19 +317,110 @@ func (s *Service) readCurrentConfig() string {
 	return string(data)
 }
 
-// writeNewConfig writes the new configuration to the file and notifies
-func (s *Service) writeNewConfig(newConfig string) {
+// ValidateConfig adapts a generated Caddyfile with Caddy if validation is enabled, JSON output
+// is built from typed structures
+func (s *Service) ValidateConfig(newConfig string) error {
+	if !s.config.Validate || s.config.Format != config.FormatCaddyfile {
+		return nil
+	}
+	return validate.Caddyfile(newConfig, s.config.Layout)
+}
+
+// writeRejectedConfig writes a rejected configuration to the side file for debugging
+func (s *Service) writeRejectedConfig(newConfig string) {
+	if s.config.RejectedFile == "" {
+		return
+	}
+	if err := ioutil.WriteFile(s.config.RejectedFile, []byte(newConfig), 0644); err != nil {
+		log.Printf("Failed to write rejected config: %v", err)
+		return
+	}
+	log.Printf("Rejected config written: %s", s.config.RejectedFile)
+}
+
+// applyConfig writes the new configuration and notifies, restoring the previous file if no
+// Caddy instance reloaded it so the file matches the config Caddy still runs. When only some
+// instances reloaded, the file is kept and the status lists the instances that failed.
+func (s *Service) applyConfig(newConfig, previousConfig string, sites []generator.SiteConfig) error {
 	err := ioutil.WriteFile(s.config.OutFile, []byte(newConfig), 0644)
 	if err != nil {
 		log.Printf("Failed to write config: %v", err)
-		return
+		s.reportStatus(ResultFailed, newConfig, err)
+		return fmt.Errorf("failed to write config: %v", err)
 	}
-	
+
 	log.Printf("Caddy config written: %s", s.config.OutFile)
-	s.notifyConfigChange()
+	update := notify.Update{Content: newConfig, Previous: s.appliedSites, Sites: sites}
+	reloaded, err := s.notifyConfigChange(update)
+	if err != nil && !reloaded {
+		log.Printf("Failed to apply config, restoring the previous one: %v", err)
+		if restoreErr := ioutil.WriteFile(s.config.OutFile, []byte(previousConfig), 0644); restoreErr != nil {
+			log.Printf("Failed to restore config: %v", restoreErr)
+			err = errors.Join(err, restoreErr)
+			s.reportStatus(ResultFailed, newConfig, err)
+			return err
+		}
+		s.reportStatus(ResultRolledBack, newConfig, err)
+		return err
+	}
+
+	s.appliedSites = sites
+	s.deliverWebhooks(update)
+	if err != nil {
+		log.Printf("Caddy config applied by some targets only, keeping %s: %v", s.config.OutFile, err)
+		s.reportStatus(ResultPartial, newConfig, err)
+		return err
+	}
+	log.Printf("Caddy config applied: %s", s.config.OutFile)
+	s.reportStatus(ResultApplied, newConfig, nil)
+	return nil
 }
 
-// notifyConfigChange notifies that the configuration has changed
-func (s *Service) notifyConfigChange() {
-	s.docker.Notify()
-} 
\ No newline at end of file
+// deliverWebhooks posts an applied change to the webhooks in the background, after the changes
+// queued before it. Webhooks do not reload Caddy, so their failures are reported in the status
+// without rolling the change back, and slow endpoints do not hold up the next check.
+func (s *Service) deliverWebhooks(update notify.Update) {
+	if s.webhooks == nil {
+		return
+	}
+	webhooks, previous, done := s.webhooks, s.delivered, make(chan struct{})
+	s.delivered = done
+	s.deliveries.Add(1)
+	go func() {
+		defer s.deliveries.Done()
+		defer close(done)
+		if previous != nil {
+			<-previous
+		}
+
+		err := webhooks.Notify(update)
+		if err != nil {
+			log.Printf("Failed to deliver webhooks: %v", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.reportWebhooks(update.Content, err)
+	}()
+}
+
+// notifyConfigChange notifies that the configuration has changed and returns whether any Caddy
+// instance reloaded it, with the joined errors of all notifiers
+func (s *Service) notifyConfigChange(update notify.Update) (bool, error) {
+	reloaded := false
+	var errs []error
+	for _, notifier := range s.notifiers {
+		err := notifier.Notify(update)
+		if err == nil {
+			reloaded = true
+			continue
+		}
+		log.Printf("Failed to notify: %v", err)
+		errs = append(errs, err)
+
+		// Containers and admin endpoints that accepted the config run it although others failed
+		for _, target := range targetResults(err) {
+			reloaded = reloaded || target.Applied
+		}
+	}
+	return reloaded, errors.Join(errs...)
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+	"github.com/gera2ld/caddy-gen/internal/docker"
+	"github.com/gera2ld/caddy-gen/internal/notify"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		OutFile:    filepath.Join(dir, "docker-sites.caddy"),
+		StatusFile: filepath.Join(dir, "status.json"),
+	}
+
+	var notifyErr error
+	s := &Service{
+		config:    cfg,
+		notifiers: []notify.Notifier{notify.ContentFunc(func(string) error { return notifyErr })},
+	}
+
+	readStatus := func() Status {
+		data, err := ioutil.ReadFile(cfg.StatusFile)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		var status Status
+		if err := json.Unmarshal(data, &status); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		return status
+	}
+
+	// Successful reload keeps the new file
+	if err := s.applyConfig("new", "", nil); err != nil {
+		t.Errorf("applyConfig() error = %v", err)
+	}
+	if current := s.readCurrentConfig(); current != "new" {
+		t.Errorf("config = %q; want new", current)
+	}
+	if status := readStatus(); status.Result != ResultApplied || status.Error != "" {
+		t.Errorf("status = %+v; want applied", status)
+	}
+
+	// Failed reload restores the previous file
+	notifyErr = errors.New("reload failed")
+	if err := s.applyConfig("broken", "new", nil); !errors.Is(err, notifyErr) {
+		t.Errorf("applyConfig() error = %v; want the notify error", err)
+	}
+	if current := s.readCurrentConfig(); current != "new" {
+		t.Errorf("config = %q; want previous config restored", current)
+	}
+	status := readStatus()
+	if status.Result != ResultRolledBack || status.Error != "reload failed" || !reflect.DeepEqual(status, s.LastStatus()) {
+		t.Errorf("status = %+v; want rolled_back with the notify error", status)
+	}
+
+	// A reload failing in some containers only keeps the new file and reports each container
+	notifyErr = &docker.NotifyError{Results: []docker.NotifyResult{
+		{Container: "caddy-1"},
+		{Container: "caddy-2", Err: errors.New("exit 1")},
+	}}
+	if err := s.applyConfig("partial", "new", nil); !errors.Is(err, notifyErr) {
+		t.Errorf("applyConfig() error = %v; want the notify error", err)
+	}
+	if current := s.readCurrentConfig(); current != "partial" {
+		t.Errorf("config = %q; want partial kept", current)
+	}
+	want := []TargetStatus{{Container: "caddy-1", Applied: true}, {Container: "caddy-2", Error: "exit 1"}}
+	if status := readStatus(); status.Result != ResultPartial || !reflect.DeepEqual(status.Targets, want) {
+		t.Errorf("status = %+v; want partial with the results of both containers", status)
+	}
+
+	// So does a config accepted by some admin endpoints only
+	notifyErr = &notify.AdminError{Results: []notify.AdminResult{
+		{Endpoint: "http://caddy-1:2019", Err: errors.New("status 500")},
+		{Endpoint: "http://caddy-2:2019"},
+	}}
+	if err := s.applyConfig("admin", "partial", nil); !errors.Is(err, notifyErr) {
+		t.Errorf("applyConfig() error = %v; want the notify error", err)
+	}
+	want = []TargetStatus{{Endpoint: "http://caddy-1:2019", Error: "status 500"}, {Endpoint: "http://caddy-2:2019", Applied: true}}
+	if status := readStatus(); status.Result != ResultPartial || !reflect.DeepEqual(status.Targets, want) || s.readCurrentConfig() != "admin" {
+		t.Errorf("status = %+v; want partial with the results of both endpoints", status)
+	}
+}
+
+func TestChangeConfigRetriesFailedConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{OutFile: filepath.Join(dir, "docker-sites.caddy")}
+	notified := 0
+	s := &Service{
+		config: cfg,
+		notifiers: []notify.Notifier{notify.ContentFunc(func(content string) error {
+			notified++
+			if content == "broken" {
+				return errors.New("reload failed")
+			}
+			return nil
+		})},
+	}
+
+	// A rolled back config is skipped until its retry is due
+	if err := s.changeConfig("broken", "", nil); err == nil {
+		t.Error("changeConfig() error = nil; want the notify error")
+	}
+	if err := s.changeConfig("broken", "", nil); err != nil || notified != 1 {
+		t.Errorf("changeConfig() error = %v after %d notifies; want the failed config skipped", err, notified)
+	}
+	if s.retryDelay != minRetryDelay || time.Until(s.retryAt) > minRetryDelay {
+		t.Errorf("retry in %v after %v; want the first retry in %v", time.Until(s.retryAt), s.retryDelay, minRetryDelay)
+	}
+
+	// A due retry notifies again and backs off further when it fails
+	s.retryAt = time.Now()
+	if err := s.changeConfig("broken", "", nil); err == nil || notified != 2 || s.retryDelay != 2*minRetryDelay {
+		t.Errorf("changeConfig() error = %v after %d notifies, delay %v; want a retry backing off", err, notified, s.retryDelay)
+	}
+
+	// A changed config is applied right away
+	if err := s.changeConfig("fixed", "", nil); err != nil || notified != 3 || s.readCurrentConfig() != "fixed" || !s.retryAt.IsZero() {
+		t.Errorf("changeConfig() error = %v after %d notifies; want the changed config applied", err, notified)
+	}
+}
+
+func TestApplyConfigWebhookFailure(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{OutFile: filepath.Join(dir, "docker-sites.caddy")}
+	webhookErr := errors.New("webhook failed")
+	var delivered []string
+	s := &Service{
+		config: cfg,
+		webhooks: notify.ContentFunc(func(content string) error {
+			delivered = append(delivered, content)
+			return webhookErr
+		}),
+	}
+
+	// A failing webhook neither fails nor rolls back the change, and deliveries keep their order
+	for _, content := range []string{"first", "second"} {
+		s.mu.Lock()
+		err := s.applyConfig(content, "", nil)
+		s.mu.Unlock()
+		if err != nil {
+			t.Errorf("applyConfig(%q) error = %v; want webhooks outside the transaction", content, err)
+		}
+	}
+	s.deliveries.Wait()
+	if current := s.readCurrentConfig(); current != "second" {
+		t.Errorf("config = %q; want second kept", current)
+	}
+	if len(delivered) != 2 || delivered[0] != "first" || delivered[1] != "second" {
+		t.Errorf("delivered = %q; want [first second]", delivered)
+	}
+	if status := s.LastStatus(); status.Result != ResultApplied || status.WebhookError != "webhook failed" {
+		t.Errorf("status = %+v; want applied with the webhook error", status)
+	}
+}
+
+func TestReload(t *testing.T) {
+	// Nothing listens on the Docker endpoint, so regenerating fails without touching the file
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:1")
+	dir := t.TempDir()
+	cfg := &config.Config{Networks: []string{"gateway"}, OutFile: filepath.Join(dir, "docker-sites.caddy")}
+	s, err := NewService(cfg)
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	defer s.Close()
+
+	stopped := false
+	s.stopWatch = func() { stopped = true }
+
+	// Settings whose notifiers cannot be created are rejected and the current ones kept
+	invalid := &config.Config{Networks: []string{"gateway"}, OutFile: cfg.OutFile,
+		Notify: &config.NotifyConfig{Webhooks: []config.WebhookConfig{{URL: "ftp://example.com"}}}}
+	if err := s.Reload(invalid); err == nil {
+		t.Error("Reload() error = nil; want error for an invalid webhook URL")
+	}
+	if s.config != cfg || stopped {
+		t.Error("Reload() swapped invalid settings; want the current ones kept")
+	}
+
+	next := &config.Config{Networks: []string{"public"}, OutFile: filepath.Join(dir, "sites.caddy"),
+		Notify: &config.NotifyConfig{Label: "caddy-gen.notify=true"}}
+	if err := s.Reload(next); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if s.config != next || len(s.notifiers) != 1 || !stopped {
+		t.Errorf("Reload() kept config %+v with %d notifiers; want new settings and the watchers stopped", s.config, len(s.notifiers))
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/gera2ld/caddy-gen/internal/docker"
+	"github.com/gera2ld/caddy-gen/internal/notify"
+)
+
+// Results of applying a config change
+const (
+	ResultApplied    = "applied"     // Written and Caddy notified successfully
+	ResultPartial    = "partial"     // Written, but some Caddy containers failed to reload it
+	ResultRolledBack = "rolled_back" // Notifying failed, the previous file was restored
+	ResultRejected   = "rejected"    // Validation failed, the previous file was kept
+	ResultFailed     = "failed"      // Writing or restoring the file failed
+)
+
+// Status is the outcome of the last config change, written to the status file for monitoring
+type Status struct {
+	Time   time.Time `json:"time"`
+	Result string    `json:"result"`
+	File   string    `json:"file"`
+	Hash   string    `json:"hash"` // SHA-256 of the generated config
+	Error  string    `json:"error,omitempty"`
+	// Targets are the results of the notified Caddy containers and admin endpoints when some
+	// of them failed
+	Targets []TargetStatus `json:"targets,omitempty"`
+	// WebhookError is why webhooks were not told about an applied change, which is kept anyway
+	WebhookError string `json:"webhookError,omitempty"`
+}
+
+// TargetStatus is the result of notifying one Caddy container or admin endpoint
+type TargetStatus struct {
+	Container string `json:"container,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Applied   bool   `json:"applied"`
+	Error     string `json:"error,omitempty"`
+}
+
+// targetResults returns the result of each target of the notifiers reaching several Caddy
+// instances, from their joined errors
+func targetResults(err error) []TargetStatus {
+	var targets []TargetStatus
+	add := func(target TargetStatus, err error) {
+		target.Applied = err == nil
+		if err != nil {
+			target.Error = err.Error()
+		}
+		targets = append(targets, target)
+	}
+
+	var notifyErr *docker.NotifyError
+	if errors.As(err, &notifyErr) {
+		for _, result := range notifyErr.Results {
+			add(TargetStatus{Container: result.Container}, result.Err)
+		}
+	}
+	var adminErr *notify.AdminError
+	if errors.As(err, &adminErr) {
+		for _, result := range adminErr.Results {
+			add(TargetStatus{Endpoint: result.Endpoint}, result.Err)
+		}
+	}
+	return targets
+}
+
+// LastStatus returns the outcome of the last config change
+func (s *Service) LastStatus() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// reportStatus records the outcome of a config change and writes it to the status file
+func (s *Service) reportStatus(result, content string, err error) {
+	s.status = Status{
+		Time:   time.Now().UTC(),
+		Result: result,
+		File:   s.config.OutFile,
+		Hash:   configHash(content),
+	}
+	if err != nil {
+		s.status.Error = err.Error()
+	}
+	s.status.Targets = targetResults(err)
+	s.writeStatus()
+}
+
+// reportWebhooks records why webhooks failed for an applied change, unless another change was
+// reported since
+func (s *Service) reportWebhooks(content string, err error) {
+	if err == nil || s.status.Hash != configHash(content) ||
+		(s.status.Result != ResultApplied && s.status.Result != ResultPartial) {
+		return
+	}
+	s.status.WebhookError = err.Error()
+	s.writeStatus()
+}
+
+// configHash returns the SHA-256 of a generated config
+func configHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeStatus writes the last status to the status file
+func (s *Service) writeStatus() {
+	if s.config.StatusFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.status, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal status: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(s.config.StatusFile, append(data, '\n'), 0644); err != nil {
+		log.Printf("Failed to write status: %v", err)
+	}
+}
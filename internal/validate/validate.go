@@ -0,0 +1,111 @@
+// Package validate adapts generated configuration with Caddy's own Caddyfile adapter
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/gera2ld/caddy-gen/internal/config"
+
+	// Register the standard directives and modules, like a stock Caddy build
+	_ "github.com/caddyserver/caddy/v2/modules/standard"
+)
+
+// filename names the generated config in adapter errors
+const filename = "caddy-gen"
+
+// lineRe matches the first position in an adapter error, which is the innermost one
+var lineRe = regexp.MustCompile(regexp.QuoteMeta(filename) + `:(\d+)`)
+
+// Error is a generated config rejected by Caddy's adapter
+type Error struct {
+	Line  int      // Line in the generated config, 0 if unknown
+	Sites []string // Names of the sites around the line, from the generated comments
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	if len(e.Sites) == 0 {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d (%s): %v", e.Line, strings.Join(e.Sites, "; "), e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Caddyfile adapts a generated Caddyfile to JSON and returns the error tied to the offending
+// sites if Caddy rejects it. In handle layout, the output is imported inside a site block, so
+// it is wrapped in one first.
+func Caddyfile(content, layout string) error {
+	body, offset := content, 0
+	if layout == config.LayoutHandle {
+		body, offset = ":443 {\n"+content+"\n}\n", 1
+	}
+
+	adapter := caddyfile.Adapter{ServerType: httpcaddyfile.ServerType{}}
+	_, _, err := adapter.Adapt([]byte(body), map[string]interface{}{"filename": filename})
+	if err == nil {
+		return nil
+	}
+
+	result := &Error{Err: err}
+	if match := lineRe.FindStringSubmatch(err.Error()); match != nil {
+		if line, _ := strconv.Atoi(match[1]); line-offset > 0 {
+			result.Line = line - offset
+			result.Sites = sitesAt(content, result.Line)
+		}
+	}
+	return result
+}
+
+// sitesAt returns the names of the sites a line belongs to, from the "# names" comment of
+// its reverse_proxy, or from all comments of its block for a host directive
+func sitesAt(content string, line int) []string {
+	lines := strings.Split(content, "\n")
+	if line > len(lines) {
+		return nil
+	}
+
+	// Find the top-level directive the block starts with
+	start := line - 1
+	for start > 0 && (isIndented(lines[start]) || strings.TrimSpace(lines[start]) == "}") {
+		start--
+	}
+
+	var comments []string
+	nearest := ""
+	for i := start; i < len(lines); i++ {
+		if i > start && lines[i] == "}" {
+			break
+		}
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "# ") {
+			continue
+		}
+		name := strings.TrimPrefix(trimmed, "# ")
+		comments = append(comments, name)
+		if i < line-1 {
+			nearest = name
+		}
+	}
+
+	// Host directives precede the proxy routes and are shared by the whole group
+	if nearest != "" {
+		return []string{nearest}
+	}
+	return comments
+}
+
+// isIndented reports whether a line is inside a block
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " ")
+}
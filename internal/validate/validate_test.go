@@ -0,0 +1,70 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gera2ld/caddy-gen/internal/config"
+)
+
+func TestCaddyfile(t *testing.T) {
+	handle := "@caddy-gen-example_com host example.com\n" +
+		"handle @caddy-gen-example_com {\n" +
+		"\ttls internal\n" +
+		"\t# web\n" +
+		"\treverse_proxy {\n" +
+		"\t\tto 172.17.0.2:80\n" +
+		"\t}\n" +
+		"\t# api\n" +
+		"\treverse_proxy /api/* {\n" +
+		"\t\tbogus on\n" +
+		"\t\tto 172.17.0.3:80\n" +
+		"\t}\n" +
+		"}\n"
+	site := "example.com {\n" +
+		"\theader_up X-A a\n" +
+		"\t# web\n" +
+		"\treverse_proxy {\n" +
+		"\t\tto 172.17.0.2:80\n" +
+		"\t}\n" +
+		"\t# api\n" +
+		"\treverse_proxy /api/* {\n" +
+		"\t\tto 172.17.0.3:80\n" +
+		"\t}\n" +
+		"}\n"
+
+	tests := []struct {
+		name    string
+		content string
+		layout  string
+		line    int
+		sites   []string
+	}{
+		{"valid handle layout", "@a host a.com\nhandle @a {\n\treverse_proxy 172.17.0.2:80\n}\n", config.LayoutHandle, 0, nil},
+		{"valid site layout", "a.com {\n\treverse_proxy 172.17.0.2:80\n}\n", config.LayoutSite, 0, nil},
+		{"empty", "", config.LayoutHandle, 0, nil},
+		{"proxy directive", handle, config.LayoutHandle, 10, []string{"api"}},
+		{"host directive", site, config.LayoutSite, 2, []string{"web", "api"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Caddyfile(tt.content, tt.layout)
+			if tt.line == 0 {
+				if err != nil {
+					t.Errorf("Caddyfile() error = %v; want nil", err)
+				}
+				return
+			}
+
+			var validateErr *Error
+			if !errors.As(err, &validateErr) {
+				t.Fatalf("Caddyfile() error = %v; want *Error", err)
+			}
+			if validateErr.Line != tt.line || !reflect.DeepEqual(validateErr.Sites, tt.sites) {
+				t.Errorf("Caddyfile() error at line %d for %v; want line %d for %v (%v)",
+					validateErr.Line, validateErr.Sites, tt.line, tt.sites, err)
+			}
+		})
+	}
+}
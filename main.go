@@ -1,34 +1,74 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 
+	"github.com/gera2ld/caddy-gen/internal/config"
 	"github.com/gera2ld/caddy-gen/internal/service"
 )
 
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1 // Listing containers, writing or notifying failed, or explain found no routes
+	exitUsage   = 2 // Invalid command line or settings
+	exitInvalid = 3 // Invalid labels, or a generated config rejected by Caddy
+)
+
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the subcommand of the command line, watch if none, and returns the exit code
+func run(args []string) int {
+	name := "watch"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", name)
+		printCommands(os.Stderr)
+		return exitUsage
+	}
+
+	// Load config
+	cfg, rest, err := config.Load("caddy-gen "+name, args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		printCommands(os.Stderr)
+		return exitOK
+	}
+	if err != nil {
+		log.Printf("Failed to load config: %v", err)
+		return exitUsage
+	}
+	if len(rest) != len(cmd.args) {
+		fmt.Fprintf(os.Stderr, "Usage: caddy-gen %s\n", cmd.synopsis())
+		return exitUsage
+	}
+
 	// Create service
-	svc, err := service.NewService()
+	svc, err := service.NewService(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create service: %v", err)
+		log.Printf("Failed to create service: %v", err)
+		return exitFailure
 	}
 	defer svc.Close()
 
-	// Handle signals
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	// Run service
-	go func() {
-		if err := svc.Run(); err != nil {
-			log.Fatalf("Service error: %v", err)
-		}
-	}()
-
-	// Wait for signal
-	sig := <-sigCh
-	log.Printf("Received signal: %v, shutting down...", sig)
-} 
\ No newline at end of file
+	return cmd.run(&invocation{flags: args[:len(args)-len(rest)], args: rest, cfg: cfg, svc: svc})
+}
+
+// printCommands prints the subcommands
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.synopsis(), cmd.usage)
+	}
+	fmt.Fprintln(w, "Flags come before the arguments, run caddy-gen <command> -h to list them.")
+}